@@ -0,0 +1,105 @@
+package hsm
+
+import (
+	"fmt"
+	"testing"
+)
+
+// benchmarkDispatch() dispatches events in turn to the annotated
+// state machine without logging, after all transitions are cached.
+func benchmarkDispatch(b *testing.B, events ...EventType) {
+	benchmarkDispatchHSM(b, newTestHSM(nil), events...)
+}
+
+// benchmarkDispatchHSM() dispatches events in turn to sm after it's warm.
+func benchmarkDispatchHSM(b *testing.B, sm *StdHSM, events ...EventType) {
+	sm.Init()
+	stdEvents := make([]Event, len(events))
+	for i, t := range events {
+		stdEvents[i] = StdEventOf(t)
+	}
+	for _, event := range stdEvents {
+		sm.Dispatch(event)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sm.Dispatch(stdEvents[i%len(stdEvents)])
+	}
+}
+
+// s11 <-> s211 across s1 and s2, with initial transitions.
+func BenchmarkStaticTransition(b *testing.B) {
+	benchmarkDispatch(b, testEventC, testEventC)
+}
+
+// s211 -> s0 -> s1 -> s11 and back by E.
+func BenchmarkStaticTransitionDeep(b *testing.B) {
+	benchmarkDispatch(b, testEventE, testEventG)
+}
+
+// s11 handles H without transition.
+func BenchmarkInternalTransition(b *testing.B) {
+	benchmarkDispatch(b, testEventH)
+}
+
+// s11 <-> s211 by QTranDyn().
+func BenchmarkDynamicTransition(b *testing.B) {
+	benchmarkDispatchHSM(b, newDynamicTestHSM(nil), testEventC, testEventC)
+}
+
+// s211 -> s0 -> s1 -> s11 and back by E with QTranDyn().
+func BenchmarkDynamicTransitionDeep(b *testing.B) {
+	benchmarkDispatchHSM(b, newDynamicTestHSM(nil), testEventE, testEventG)
+}
+
+// newChainHSM() builds the state machine of a chain of states d1, d2, ...
+// down to the leaf of depth under top, where d1 handles event A without
+// transition.
+func newChainHSM(depth int) *StdHSM {
+	top := NewTop()
+	initial := NewInitial(top, "d1")
+	var super State = top
+	for i := 1; i <= depth; i++ {
+		var init string
+		if i < depth {
+			init = fmt.Sprintf("d%d", i+1)
+		}
+		var trans map[EventType]string
+		if i == 1 {
+			trans = map[EventType]string{testEventA: ""}
+		}
+		super = newTestState(super, fmt.Sprintf("d%d", i), init, trans, nil)
+	}
+	return NewStdHSM(HSMTypeStd, top, initial)
+}
+
+// Dispatch2() up the hierarchy from the leaf to d1 at several depths.
+func BenchmarkDispatchDepth(b *testing.B) {
+	for _, depth := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			benchmarkDispatchHSM(b, newChainHSM(depth), testEventA)
+		})
+	}
+}
+
+// QTranSetup() on the first occurrence of every transition, since
+// nothing is cached.
+func BenchmarkQTranSetup(b *testing.B) {
+	sm := newTestHSM(nil)
+	sm.SetTranCache(&DisabledTranCache{})
+	benchmarkDispatchHSM(b, sm, testEventC, testEventC)
+}
+
+// Init2() of the annotated state machine, which is reset to be
+// initialized again every time.
+func BenchmarkInit(b *testing.B) {
+	sm := newTestHSM(nil)
+	top, initial := sm.StateTable[TopStateID], sm.StateTable[InitialStateID]
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sm.State, sm.SourceState = top, initial
+		sm.Init()
+	}
+}
@@ -0,0 +1,34 @@
+package hsm
+
+import "time"
+
+// Clock schedules the time events of state machines. The states which
+// arm timeouts should take a Clock instead of calling package time
+// directly, so that tests could replace it by a fake clock.
+type Clock interface {
+	// Now() returns the current time.
+	Now() time.Time
+	// AfterFunc() calls f after duration d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call scheduled by Clock.AfterFunc().
+type Timer interface {
+	// Stop() prevents the call from happening. It returns false if
+	// the call has already happened or been stopped.
+	Stop() bool
+}
+
+// SystemClock is the Clock of package time. Its calls happen on their own
+// goroutines, which must be synchronized with the dispatching.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
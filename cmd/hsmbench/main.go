@@ -0,0 +1,67 @@
+// hsmbench reports the results of the benchmarks of go-hsm, and compares
+// them across runs so that performance regressions become visible.
+//
+// Usage:
+//
+//	go test -run xxx -bench . -benchmem -count 5 github.com/hhkbp2/go-hsm > old.txt
+//	# change codes
+//	go test -run xxx -bench . -benchmem -count 5 github.com/hhkbp2/go-hsm > new.txt
+//	hsmbench [-threshold 10] old.txt new.txt
+//
+// With a single file, the results are reported as a table. With two files,
+// the changes from the old results to the new ones are reported, and
+// the benchmarks slower by more than threshold percent or allocating more
+// are marked with '!'. It exits with status 1 if there is any of them.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	threshold := flag.Float64("threshold", 10,
+		"percent of slowdown reported as a regression")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr,
+			"usage: hsmbench [-threshold percent] results-file [new-results-file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 && flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var results []map[string]*result
+	for _, path := range flag.Args() {
+		r, err := parseFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "hsmbench: %v\n", err)
+			os.Exit(1)
+		}
+		results = append(results, r)
+	}
+	if len(results) == 1 {
+		report(os.Stdout, results[0])
+		return
+	}
+	regressions := compare(os.Stdout, results[0], results[1], *threshold)
+	if len(regressions) != 0 {
+		fmt.Fprintf(os.Stderr, "hsmbench: %d regressions\n", len(regressions))
+		os.Exit(1)
+	}
+}
+
+func parseFile(path string) (map[string]*result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	results, err := parse(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// result is the mean of the runs of a benchmark.
+type result struct {
+	name string
+	// The number of runs
+	runs        int
+	nsPerOp     float64
+	bytesPerOp  float64
+	allocsPerOp float64
+}
+
+// procsSuffix matches the GOMAXPROCS suffix of benchmark names, e.g. "-8".
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// parse() reads the output of "go test -bench" and returns the results by
+// names. The runs of the same benchmark, e.g. by -count, are averaged.
+func parse(r io.Reader) (map[string]*result, error) {
+	results := make(map[string]*result)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		run := &result{name: name, runs: 1}
+		// the iterations are followed by pairs of value and unit
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: bad value %q", name, fields[i])
+			}
+			switch fields[i+1] {
+			case "ns/op":
+				run.nsPerOp = value
+			case "B/op":
+				run.bytesPerOp = value
+			case "allocs/op":
+				run.allocsPerOp = value
+			}
+		}
+		if old, ok := results[name]; ok {
+			n := float64(old.runs)
+			old.nsPerOp = (old.nsPerOp*n + run.nsPerOp) / (n + 1)
+			old.bytesPerOp = (old.bytesPerOp*n + run.bytesPerOp) / (n + 1)
+			old.allocsPerOp = (old.allocsPerOp*n + run.allocsPerOp) / (n + 1)
+			old.runs++
+		} else {
+			results[name] = run
+		}
+	}
+	return results, scanner.Err()
+}
+
+// sortedNames() returns the names in results in order.
+func sortedNames(results ...map[string]*result) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, r := range results {
+		for name := range r {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// report() writes the table of results.
+func report(w io.Writer, results map[string]*result) {
+	fmt.Fprintf(w, "%-40s %12s %10s %10s\n", "name", "ns/op", "B/op", "allocs/op")
+	for _, name := range sortedNames(results) {
+		r := results[name]
+		fmt.Fprintf(w, "%-40s %12.1f %10.0f %10.0f\n",
+			name, r.nsPerOp, r.bytesPerOp, r.allocsPerOp)
+	}
+}
+
+// compare() writes the table of changes from old to new results,
+// and returns the names of the benchmarks which regressed: slower by
+// more than threshold percent, or allocating more.
+func compare(w io.Writer, old, new map[string]*result, threshold float64) []string {
+	var regressions []string
+	fmt.Fprintf(w, "%-40s %12s %12s %8s %14s\n",
+		"name", "old ns/op", "new ns/op", "delta", "allocs/op")
+	for _, name := range sortedNames(old, new) {
+		o, n := old[name], new[name]
+		switch {
+		case o == nil:
+			fmt.Fprintf(w, "%-40s %12s %12.1f %8s %14.0f\n",
+				name, "-", n.nsPerOp, "new", n.allocsPerOp)
+			continue
+		case n == nil:
+			fmt.Fprintf(w, "%-40s %12.1f %12s %8s %14.0f\n",
+				name, o.nsPerOp, "-", "gone", o.allocsPerOp)
+			continue
+		}
+		delta := 0.0
+		if o.nsPerOp != 0 {
+			delta = (n.nsPerOp - o.nsPerOp) / o.nsPerOp * 100
+		}
+		mark := ""
+		if delta > threshold || n.allocsPerOp > o.allocsPerOp {
+			mark = "  !"
+			regressions = append(regressions, name)
+		}
+		allocs := fmt.Sprintf("%.0f -> %.0f", o.allocsPerOp, n.allocsPerOp)
+		fmt.Fprintf(w, "%-40s %12.1f %12.1f %+7.1f%% %14s%s\n",
+			name, o.nsPerOp, n.nsPerOp, delta, allocs, mark)
+	}
+	return regressions
+}
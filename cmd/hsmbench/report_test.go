@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testOld = `goos: linux
+goarch: amd64
+pkg: github.com/hhkbp2/go-hsm
+BenchmarkStaticTransition-8    	 2000000	       400.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkStaticTransition-8    	 2000000	       420.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkDispatchDepth/depth=4-8	 2000000	       100.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkInit-8                	 1000000	       700.0 ns/op
+PASS
+`
+
+const testNew = `BenchmarkStaticTransition-8    	 2000000	       405.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkDispatchDepth/depth=4-8	 2000000	       150.0 ns/op	       0 B/op	       0 allocs/op
+BenchmarkQTranSetup-8          	 1000000	       800.0 ns/op	     288 B/op	       5 allocs/op
+`
+
+func TestParse(t *testing.T) {
+	results, err := parse(strings.NewReader(testOld))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	static := results["BenchmarkStaticTransition"]
+	assert.Equal(t, 2, static.runs)
+	assert.Equal(t, 410.0, static.nsPerOp)
+	assert.Equal(t, 700.0, results["BenchmarkInit"].nsPerOp)
+	assert.NotNil(t, results["BenchmarkDispatchDepth/depth=4"])
+
+	var buf bytes.Buffer
+	report(&buf, results)
+	assert.Contains(t, buf.String(), "BenchmarkStaticTransition")
+	assert.Contains(t, buf.String(), "410.0")
+}
+
+func TestCompare(t *testing.T) {
+	old, err := parse(strings.NewReader(testOld))
+	assert.Nil(t, err)
+	new, err := parse(strings.NewReader(testNew))
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	regressions := compare(&buf, old, new, 10)
+	assert.Equal(t, []string{"BenchmarkDispatchDepth/depth=4"}, regressions)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 5, len(lines))
+	assert.Contains(t, buf.String(), "+50.0%")
+	assert.Contains(t, buf.String(), "gone")
+	assert.Contains(t, buf.String(), "new")
+	// within the threshold
+	assert.Equal(t, 0, len(compare(&buf, old, new, 60)))
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+)
+
+// runValidate() checks the structure of definitions, and prints
+// the warnings found by Lint().
+func runValidate(args []string, stdout io.Writer) error {
+	flags := newFlagSet("validate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errUsage
+	}
+	failed := 0
+	for _, path := range flags.Args() {
+		definition, err := definition.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stdout, "%v\n", err)
+			failed++
+			continue
+		}
+		warnings := definition.Lint()
+		for _, warning := range warnings {
+			fmt.Fprintf(stdout, "%s: warning: %s\n", path, warning)
+		}
+		if len(warnings) == 0 {
+			fmt.Fprintf(stdout, "%s: ok\n", path)
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d definitions are invalid",
+			failed, flags.NArg())
+	}
+	return nil
+}
+
+// runRender() writes the state chart of definition.
+func runRender(args []string, stdout io.Writer) error {
+	flags := newFlagSet("render")
+	format := flags.String("format", "dot", "output format: dot, mermaid or plantuml")
+	output := flags.String("o", "", "output file (default standard output)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	sm, err := load(flags.Arg(0), nil, nil)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return render(sm, stdout, *format)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := render(sm, file, *format); err != nil {
+		file.Close()
+		return err
+	}
+	// the chart may not be completely written until the file is closed
+	return file.Close()
+}
+
+// render() writes the state chart of sm to w in format.
+func render(sm *hsm.StdHSM, w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return hsm.ExportDOT(sm, w, nil)
+	case "mermaid":
+		return hsm.ExportMermaid(sm, w, nil)
+	case "plantuml":
+		return hsm.ExportPlantUML(sm, w, nil)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// guardFlags collects the -guard flags of simulate.
+type guardFlags map[string]bool
+
+func (self guardFlags) String() string {
+	return fmt.Sprint(map[string]bool(self))
+}
+
+func (self guardFlags) Set(value string) error {
+	var name, result string
+	if i := strings.Index(value, "="); i >= 0 {
+		name, result = value[:i], value[i+1:]
+	} else {
+		name, result = value, "true"
+	}
+	switch result {
+	case "true":
+		self[name] = true
+	case "false":
+		self[name] = false
+	default:
+		return fmt.Errorf("guard %q should be true or false", name)
+	}
+	return nil
+}
+
+// runSimulate() dispatches the scripted events to definition, and prints
+// the trace of every step.
+func runSimulate(args []string, stdout io.Writer) error {
+	flags := newFlagSet("simulate")
+	guards := make(guardFlags)
+	flags.Var(guards, "guard",
+		"fix the result of guard as name=true or name=false (default true)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 && flags.NArg() != 2 {
+		return errUsage
+	}
+	var events io.Reader = os.Stdin
+	if flags.NArg() == 2 {
+		file, err := os.Open(flags.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		events = file
+	}
+	sm, err := load(flags.Arg(0), stdout, guards)
+	if err != nil {
+		return err
+	}
+	return simulate(sm, events, stdout)
+}
+
+// simulate() runs the events read from r, and prints the trace to w.
+func simulate(sm *hsm.StdHSM, r io.Reader, w io.Writer) error {
+	sm.AddObserver(hsm.ObserverFunc(func(record *hsm.TraceRecord) {
+		fmt.Fprintf(w, "  %s\n", record)
+	}))
+	fmt.Fprintf(w, "init\n")
+	sm.Init()
+	fmt.Fprintf(w, "state %s\n", sm.GetState().ID())
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		eventType, ok := hsm.LookupEventType(name)
+		if !ok {
+			return fmt.Errorf("line %d: unknown event %q", line, name)
+		}
+		if hsm.IsReservedEventType(eventType) {
+			return fmt.Errorf("line %d: event %q is reserved", line, name)
+		}
+		fmt.Fprintf(w, "event %s\n", name)
+		sm.Dispatch(hsm.NewStdEvent(eventType))
+		fmt.Fprintf(w, "state %s\n", sm.GetState().ID())
+	}
+	return scanner.Err()
+}
+
+// load() reads and builds the definition at path. Every action prints
+// its name to log if log is not nil. Guards hold unless fixed in guards.
+func load(
+	path string, log io.Writer, guards map[string]bool) (*hsm.StdHSM, error) {
+
+	definition, err := definition.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := stubBindings(definition, log, guards)
+	if err != nil {
+		return nil, err
+	}
+	return hsm.Build(definition, bindings)
+}
+
+// stubBindings() binds all the actions and guards of definition to stubs,
+// see load().
+func stubBindings(definition *hsm.Definition,
+	log io.Writer, guards map[string]bool) (*hsm.Bindings, error) {
+
+	bindings := hsm.NewBindings()
+	for _, name := range definition.ActionNames() {
+		name := name
+		bindings.BindAction(name, func(sm hsm.HSM, event hsm.Event) {
+			if log != nil {
+				fmt.Fprintf(log, "  action %s\n", name)
+			}
+		})
+	}
+	for _, name := range definition.GuardNames() {
+		result, ok := guards[name]
+		if !ok {
+			result = true
+		}
+		bindings.BindGuard(name, func(sm hsm.HSM, event hsm.Event) bool {
+			return result
+		})
+	}
+	for name := range guards {
+		if _, ok := bindings.Guards[name]; !ok {
+			return nil, fmt.Errorf("unknown guard %q", name)
+		}
+	}
+	return bindings, nil
+}
+
+// runDiff() prints the differences between two definitions.
+func runDiff(args []string, stdout io.Writer) error {
+	flags := newFlagSet("diff")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return errUsage
+	}
+	older, err := definition.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	newer, err := definition.ReadFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	for _, line := range diff(older, newer) {
+		fmt.Fprintln(stdout, line)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDefinition = `
+name: door
+states:
+  - id: closed
+    entry: [lightOff]
+    transitions:
+      - {event: open, target: opened, guard: unlocked}
+  - id: opened
+    transitions:
+      - {event: close, target: closed}
+`
+
+func readDefinition(t *testing.T, doc string) *hsm.Definition {
+	definition, err := definition.Read(strings.NewReader(doc), definition.FormatYAML)
+	assert.Nil(t, err)
+	return definition
+}
+
+func newTestHSM(t *testing.T) *hsm.StdHSM {
+	bindings := hsm.NewBindings().
+		BindAction("lightOff", func(sm hsm.HSM, event hsm.Event) {}).
+		BindGuard("unlocked", func(sm hsm.HSM, event hsm.Event) bool {
+			return true
+		})
+	sm, err := hsm.Build(readDefinition(t, testDefinition), bindings)
+	assert.Nil(t, err)
+	return sm
+}
+
+func TestSimulate(t *testing.T) {
+	var out bytes.Buffer
+	err := simulate(newTestHSM(t),
+		strings.NewReader("# script\nopen\n\nclose\n"), &out)
+	assert.Nil(t, err)
+	assert.Equal(t, `init
+  Initial-Init
+  closed-Entry
+state closed
+event open
+  closed-Exit
+  opened-Entry
+  closed-Handle(open)
+state opened
+event close
+  opened-Exit
+  closed-Entry
+  opened-Handle(close)
+state closed
+`, out.String())
+	err = simulate(newTestHSM(t), strings.NewReader("bogus\n"), &out)
+	assert.NotNil(t, err)
+	err = simulate(newTestHSM(t), strings.NewReader("open\nExit\n"), &out)
+	assert.EqualError(t, err, `line 2: event "Exit" is reserved`)
+}
+
+func TestDiff(t *testing.T) {
+	older := readDefinition(t, testDefinition)
+	newer := readDefinition(t, `
+name: door
+version: 2
+states:
+  - id: closed
+    transitions:
+      - {event: open, target: ajar, guard: unlocked}
+      - {event: lock, target: locked}
+  - id: ajar
+  - id: locked
+`)
+	assert.Equal(t, []string{
+		"~ version: 0 -> 2",
+		"- state opened",
+		"~ state closed entry: [lightOff] -> []",
+		"- transition closed --open [unlocked]--> opened",
+		"+ transition closed --open [unlocked]--> ajar",
+		"+ transition closed --lock--> locked",
+		"+ state ajar (in TOP)",
+		"+ state locked (in TOP)",
+	}, diff(older, newer))
+}
+
+func TestDiffTransitions(t *testing.T) {
+	older := readDefinition(t, `
+states:
+  - id: a
+    transitions:
+      - {event: x, guard: g, target: b}
+      - {event: x, target: c}
+      - {event: y, actions: [beep]}
+      - {event: y, actions: [beep]}
+  - id: b
+  - id: c
+`)
+	newer := readDefinition(t, `
+states:
+  - id: a
+    transitions:
+      - {event: x, guard: g, target: b, actions: [beep]}
+      - {event: x, target: b}
+      - {event: y, actions: [beep]}
+  - id: b
+  - id: c
+`)
+	assert.Equal(t, []string{
+		"- transition a --x--> c",
+		"- transition a --y / beep--> (internal)",
+		"~ transition a --x [g]--> b -> a --x [g] / beep--> b",
+		"+ transition a --x--> b",
+	}, diff(older, newer))
+	assert.Equal(t, []string(nil), diff(older, older))
+}
+
+func TestRender(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "door.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testDefinition), 0644))
+	output := filepath.Join(dir, "door.mmd")
+	var out bytes.Buffer
+	assert.Nil(t, runRender(
+		[]string{"-format", "mermaid", "-o", output, path}, &out))
+	assert.Equal(t, 0, out.Len())
+	data, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "stateDiagram-v2\n"))
+
+	assert.Nil(t, runRender([]string{"-format", "dot", path}, &out))
+	assert.Contains(t, out.String(), "digraph")
+	assert.NotNil(t, runRender([]string{"-format", "svg", path}, &out))
+	assert.NotNil(t, runRender(
+		[]string{"-o", filepath.Join(dir, "none", "door.dot"), path}, &out))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// flatState is a state in definition with its position in hierarchy.
+type flatState struct {
+	def    *hsm.StateDefinition
+	parent string
+	// the initial child, resolved when omitted
+	initial string
+}
+
+// flatten() indexes all states in definition by ID.
+func flatten(definition *hsm.Definition) (map[string]*flatState, []string) {
+	states := make(map[string]*flatState)
+	var order []string
+	var walk func(parent string, def *hsm.StateDefinition)
+	walk = func(parent string, def *hsm.StateDefinition) {
+		state := &flatState{def: def, parent: parent, initial: def.Initial}
+		if state.initial == "" && len(def.States) != 0 {
+			state.initial = def.States[0].ID
+		}
+		states[def.ID] = state
+		order = append(order, def.ID)
+		for _, child := range def.States {
+			walk(def.ID, child)
+		}
+	}
+	for _, def := range definition.States {
+		walk(hsm.TopStateID, def)
+	}
+	return states, order
+}
+
+// transitionLabel() formats the trigger of a transition as "event [guard]".
+func transitionLabel(tran *hsm.TransitionDefinition) string {
+	if tran.Guard == "" {
+		return tran.Event
+	}
+	return tran.Event + " [" + tran.Guard + "]"
+}
+
+// transitionKey() identifies a transition within its state by its event,
+// guard and target, so that transitions on the same event are told apart.
+func transitionKey(tran *hsm.TransitionDefinition) string {
+	return transitionLabel(tran) + " -> " + tran.Target
+}
+
+// describeTransition() formats a transition as
+// "source --event [guard] / actions--> target".
+func describeTransition(source string, tran *hsm.TransitionDefinition) string {
+	label := transitionLabel(tran)
+	if len(tran.Actions) != 0 {
+		label += " / " + strings.Join(tran.Actions, ", ")
+	}
+	target := tran.Target
+	if target == "" {
+		target = "(internal)"
+	}
+	return fmt.Sprintf("%s --%s--> %s", source, label, target)
+}
+
+// matchTransitions() pairs the transitions of older and newer with the same
+// key in order, so that duplicate transitions are matched one by one.
+// It returns the transition of older matched by each one of newer, nil if
+// it's added, and the transitions of older not matched.
+func matchTransitions(older, newer []*hsm.TransitionDefinition) (
+	[]*hsm.TransitionDefinition, []*hsm.TransitionDefinition) {
+
+	pending := make(map[string][]*hsm.TransitionDefinition)
+	for _, tran := range older {
+		key := transitionKey(tran)
+		pending[key] = append(pending[key], tran)
+	}
+	matched := make([]*hsm.TransitionDefinition, len(newer))
+	for i, tran := range newer {
+		key := transitionKey(tran)
+		if trans := pending[key]; len(trans) != 0 {
+			matched[i] = trans[0]
+			pending[key] = trans[1:]
+		}
+	}
+	var removed []*hsm.TransitionDefinition
+	for _, tran := range older {
+		key := transitionKey(tran)
+		if trans := pending[key]; len(trans) != 0 && trans[0] == tran {
+			removed = append(removed, tran)
+			pending[key] = trans[1:]
+		}
+	}
+	return matched, removed
+}
+
+// diff() describes the differences from definition older to newer,
+// a line for each difference. Lines start with '-' for removed, '+' for
+// added and '~' for changed.
+func diff(older, newer *hsm.Definition) []string {
+	var lines []string
+	add := func(format string, v ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, v...))
+	}
+	oldStates, oldOrder := flatten(older)
+	newStates, newOrder := flatten(newer)
+	oldInitial, newInitial := older.Initial, newer.Initial
+	if oldInitial == "" {
+		oldInitial = older.States[0].ID
+	}
+	if newInitial == "" {
+		newInitial = newer.States[0].ID
+	}
+	if older.Version != newer.Version {
+		add("~ version: %d -> %d", older.Version, newer.Version)
+	}
+	if oldInitial != newInitial {
+		add("~ initial state: %s -> %s", oldInitial, newInitial)
+	}
+	for _, id := range oldOrder {
+		if _, ok := newStates[id]; !ok {
+			add("- state %s", id)
+		}
+	}
+	for _, id := range newOrder {
+		newer := newStates[id]
+		older, ok := oldStates[id]
+		if !ok {
+			add("+ state %s (in %s)", id, newer.parent)
+			for _, tran := range newer.def.Transitions {
+				add("+ transition %s", describeTransition(id, tran))
+			}
+			continue
+		}
+		if older.parent != newer.parent {
+			add("~ state %s moved: %s -> %s", id, older.parent, newer.parent)
+		}
+		if older.initial != newer.initial {
+			add("~ state %s initial: %s -> %s", id, older.initial, newer.initial)
+		}
+		if older.def.Final != newer.def.Final {
+			add("~ state %s final: %v -> %v", id, older.def.Final, newer.def.Final)
+		}
+		if !reflect.DeepEqual(older.def.Entry, newer.def.Entry) {
+			add("~ state %s entry: [%s] -> [%s]", id,
+				strings.Join(older.def.Entry, ", "),
+				strings.Join(newer.def.Entry, ", "))
+		}
+		if !reflect.DeepEqual(older.def.Exit, newer.def.Exit) {
+			add("~ state %s exit: [%s] -> [%s]", id,
+				strings.Join(older.def.Exit, ", "),
+				strings.Join(newer.def.Exit, ", "))
+		}
+		matched, removed := matchTransitions(
+			older.def.Transitions, newer.def.Transitions)
+		for _, tran := range removed {
+			add("- transition %s", describeTransition(id, tran))
+		}
+		for i, tran := range newer.def.Transitions {
+			old := matched[i]
+			switch {
+			case old == nil:
+				add("+ transition %s", describeTransition(id, tran))
+			case !reflect.DeepEqual(old, tran):
+				add("~ transition %s -> %s", describeTransition(id, old),
+					describeTransition(id, tran))
+			}
+		}
+	}
+	return lines
+}
@@ -0,0 +1,84 @@
+// hsmctl inspects the state machine definitions in YAML, JSON or SCXML.
+//
+// Usage:
+//
+//	hsmctl validate definition-file...
+//	hsmctl render [-format dot|mermaid|plantuml] [-o output] definition-file
+//	hsmctl simulate [-guard name=false]... definition-file [events-file]
+//	hsmctl diff old-definition-file new-definition-file
+//	hsmctl repl [-guard name=false]... definition-file
+//
+// The events file for simulate lists one event name per line. Blank lines
+// and lines started with '#' are ignored. Events are read from the
+// standard input if the events file is omitted.
+//
+// repl prompts for commands to drive the machine by hand, see package repl.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// command is a subcommand of hsmctl.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, stdout io.Writer) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"validate", "definition-file...", runValidate},
+		{"render", "[-format dot|mermaid|plantuml] [-o output] definition-file", runRender},
+		{"simulate", "[-guard name=false]... definition-file [events-file]", runSimulate},
+		{"diff", "old-definition-file new-definition-file", runDiff},
+		{"repl", "[-guard name=false]... definition-file", runREPL},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  hsmctl %s %s\n", cmd.name, cmd.usage)
+	}
+	os.Exit(2)
+}
+
+// errUsage is returned by commands on bad arguments.
+var errUsage = fmt.Errorf("bad usage")
+
+// newFlagSet() returns the flag set for cmd which reports errors
+// by returning rather than exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet("hsmctl "+name, flag.ContinueOnError)
+	flags.SetOutput(os.Stderr)
+	return flags
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, cmd := range commands {
+		if cmd.name != os.Args[1] {
+			continue
+		}
+		err := cmd.run(os.Args[2:], os.Stdout)
+		switch err {
+		case nil:
+			return
+		case errUsage, flag.ErrHelp:
+			fmt.Fprintf(os.Stderr, "usage: hsmctl %s %s\n", cmd.name, cmd.usage)
+			os.Exit(2)
+		default:
+			fmt.Fprintf(os.Stderr, "hsmctl %s: %v\n", cmd.name, err)
+			os.Exit(1)
+		}
+	}
+	usage()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/hhkbp2/go-hsm/repl"
+)
+
+// runREPL() prompts for commands on the standard input to drive
+// the machine of definition by hand.
+func runREPL(args []string, stdout io.Writer) error {
+	flags := newFlagSet("repl")
+	guards := make(guardFlags)
+	flags.Var(guards, "guard",
+		"fix the result of guard as name=true or name=false (default true)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	definition, err := definition.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	bindings, err := stubBindings(definition, stdout, guards)
+	if err != nil {
+		return err
+	}
+	if _, err := hsm.Build(definition, bindings); err != nil {
+		return err
+	}
+	factory := func() repl.Machine {
+		sm, err := hsm.Build(definition, bindings)
+		hsm.AssertNil(err)
+		return sm
+	}
+	return repl.New(factory, stdout).Run(os.Stdin)
+}
@@ -0,0 +1,112 @@
+// hsmgen generates the Go codes of state machine from a definition file
+// in YAML, JSON or SCXML. It's intended to be used with go:generate:
+//
+//	//go:generate hsmgen -package door door.yaml
+//
+// Two files are written beside the definition file, e.g. for door.yaml:
+//
+//	door_hsm.go       the states and the HSM type, overwritten every time
+//	door_handlers.go  the actions and guards, written by hand
+//
+// The handlers file is created with stubs on the first run. After that,
+// only the stubs of new actions and guards are appended to it.
+//
+// With -mode switch, two more files are overwritten every time:
+//
+//	door_switch.go       the state machine dispatching by switch statements
+//	door_switch_test.go  the test of its equivalence to door_hsm.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/codegen"
+	"github.com/hhkbp2/go-hsm/definition"
+)
+
+func main() {
+	pkg := flag.String("package", "", "package of the generated files")
+	name := flag.String("name", "",
+		"prefix of the generated type names (default the definition name)")
+	output := flag.String("output", "",
+		"prefix of the generated file paths (default the definition path without extension)")
+	mode := flag.String("mode", "hsm",
+		"hsm to generate the HSM type only, or switch to generate the switch based type as well")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr,
+			"usage: hsmgen -package name [flags] definition-file\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || *pkg == "" || (*mode != "hsm" && *mode != "switch") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := generate(flag.Arg(0), *pkg, *name, *output, *mode); err != nil {
+		fmt.Fprintf(os.Stderr, "hsmgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func generate(path, pkg, name, output, mode string) error {
+	definition, err := definition.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if output == "" {
+		output = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	opts := &codegen.Options{
+		Package: pkg,
+		Name:    name,
+		Source:  filepath.Base(path),
+	}
+	states, err := codegen.GenerateStates(definition, opts)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(output+"_hsm.go", states, 0644); err != nil {
+		return err
+	}
+	if mode == "switch" {
+		if err := generateSwitch(definition, opts, output); err != nil {
+			return err
+		}
+	}
+	handlersPath := output + "_handlers.go"
+	existing, err := ioutil.ReadFile(handlersPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	handlers, err := codegen.GenerateHandlers(definition, opts, existing)
+	if err != nil {
+		return err
+	}
+	if existing != nil && string(existing) == string(handlers) {
+		return nil
+	}
+	return ioutil.WriteFile(handlersPath, handlers, 0644)
+}
+
+func generateSwitch(
+	definition *hsm.Definition, opts *codegen.Options, output string) error {
+
+	source, err := codegen.GenerateSwitch(definition, opts)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(output+"_switch.go", source, 0644); err != nil {
+		return err
+	}
+	test, err := codegen.GenerateSwitchTest(definition, opts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output+"_switch_test.go", test, 0644)
+}
@@ -0,0 +1,326 @@
+// Package codegen generates Go source codes for state machines described
+// by hsm.Definition, so that the states need not to be written by hand.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"reflect"
+	"text/template"
+	"unicode"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// Options controls the code generation.
+type Options struct {
+	// The package of generated files
+	Package string
+	// The prefix of generated type names, the name of definition
+	// is used if empty
+	Name string
+	// The spec file generated from, mentioned in the generated header
+	Source string
+}
+
+// GoName() converts name into an exported Go identifier in camel case,
+// e.g. "locked_quiet" to "LockedQuiet", "s211" to "S211".
+func GoName(name string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	s := buf.String()
+	if s == "" || unicode.IsDigit([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
+
+// The methods and fields of the generated HSM type, which could not be
+// used as the names of actions or guards. Those promoted from StdHSM are
+// looked up by reflection, so that they are never out of date.
+var reservedMethods = func() map[string]bool {
+	reserved := map[string]bool{
+		"StdHSM": true, "CurrentStateID": true, "ExtendedState": true,
+	}
+	t := reflect.TypeOf(&hsm.StdHSM{})
+	for i := 0; i < t.NumMethod(); i++ {
+		reserved[t.Method(i).Name] = true
+	}
+	for i := 0; i < t.Elem().NumField(); i++ {
+		if field := t.Elem().Field(i); field.IsExported() {
+			reserved[field.Name] = true
+		}
+	}
+	return reserved
+}()
+
+// model is the data which templates generate codes from.
+type model struct {
+	Options
+	// The type name of generated HSM
+	HSMType string
+	// The type name of the extended state data written by user
+	DataType string
+	// The version of definition
+	Version int
+	// The initial state under top
+	Initial *stateModel
+	States  []*stateModel
+	Events  []*eventModel
+	Actions []*nameModel
+	Guards  []*nameModel
+}
+
+type stateModel struct {
+	ID      string
+	GoName  string
+	Super   *stateModel
+	Initial *stateModel
+	Final   bool
+	Entry   []*nameModel
+	Exit    []*nameModel
+	// The transitions grouped by event in definition order
+	Handlers []*handlerModel
+	// The index of this state in model.States
+	Index int
+}
+
+// VarName() returns the name of local variable for this state.
+func (self *stateModel) VarName() string {
+	r := []rune(self.GoName)
+	return string(unicode.ToLower(r[0])) + string(r[1:]) + "State"
+}
+
+// CallsHSM() tests whether the handler of this state calls any
+// action or guard, which are methods of the HSM type.
+func (self *stateModel) CallsHSM() bool {
+	for _, handler := range self.Handlers {
+		for _, tran := range handler.Transitions {
+			if tran.Guard != nil || len(tran.Actions) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type eventModel struct {
+	Name   string
+	GoName string
+}
+
+type nameModel struct {
+	Name   string
+	GoName string
+}
+
+type handlerModel struct {
+	Event       *eventModel
+	Transitions []*transitionModel
+}
+
+type transitionModel struct {
+	Target  *stateModel
+	Guard   *nameModel
+	Actions []*nameModel
+}
+
+// newModel() checks definition and builds the model for templates.
+func newModel(definition *hsm.Definition, opts *Options) (*model, error) {
+	if err := definition.Validate(nil); err != nil {
+		return nil, err
+	}
+	if opts.Package == "" {
+		return nil, fmt.Errorf("package name is not specified")
+	}
+	name := opts.Name
+	if name == "" {
+		name = definition.Name
+	}
+	if name == "" {
+		return nil, fmt.Errorf("definition has no name")
+	}
+	m := &model{
+		Options:  *opts,
+		HSMType:  GoName(name) + "HSM",
+		DataType: GoName(name) + "Data",
+		Version:  definition.Version,
+	}
+	m.Name = name
+	states := make(map[string]*stateModel)
+	goNames := make(map[string]string)
+	claim := func(goName, name string) error {
+		if old, ok := goNames[goName]; ok && old != name {
+			return fmt.Errorf("both %q and %q are named %s in Go",
+				old, name, goName)
+		}
+		goNames[goName] = name
+		return nil
+	}
+	var collect func(super *stateModel, def *hsm.StateDefinition) error
+	collect = func(super *stateModel, def *hsm.StateDefinition) error {
+		if def.History != "" {
+			return fmt.Errorf("history state %q is not supported", def.ID)
+		}
+		state := &stateModel{
+			ID:     def.ID,
+			GoName: GoName(def.ID),
+			Super:  super,
+			Final:  def.Final,
+			Index:  len(m.States),
+		}
+		if err := claim(state.GoName+"State", def.ID); err != nil {
+			return err
+		}
+		states[def.ID] = state
+		m.States = append(m.States, state)
+		for _, child := range def.States {
+			if err := collect(state, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, def := range definition.States {
+		if err := collect(nil, def); err != nil {
+			return nil, err
+		}
+	}
+	events := make(map[string]*eventModel)
+	actions := make(map[string]*nameModel)
+	guards := make(map[string]*nameModel)
+	lookup := func(
+		table map[string]*nameModel, list *[]*nameModel,
+		name string) (*nameModel, error) {
+
+		if n, ok := table[name]; ok {
+			return n, nil
+		}
+		n := &nameModel{Name: name, GoName: GoName(name)}
+		if reservedMethods[n.GoName] {
+			return nil, fmt.Errorf("%q is reserved as method %s",
+				name, n.GoName)
+		}
+		if err := claim(n.GoName, name); err != nil {
+			return nil, err
+		}
+		table[name] = n
+		*list = append(*list, n)
+		return n, nil
+	}
+	names := func(list []string) ([]*nameModel, error) {
+		var result []*nameModel
+		for _, name := range list {
+			n, err := lookup(actions, &m.Actions, name)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, n)
+		}
+		return result, nil
+	}
+	var resolve func(def *hsm.StateDefinition) error
+	resolve = func(def *hsm.StateDefinition) error {
+		var err error
+		state := states[def.ID]
+		if len(def.States) != 0 {
+			init := def.Initial
+			if init == "" {
+				init = def.States[0].ID
+			}
+			state.Initial = states[init]
+		}
+		if state.Entry, err = names(def.Entry); err != nil {
+			return err
+		}
+		if state.Exit, err = names(def.Exit); err != nil {
+			return err
+		}
+		for _, tran := range def.Transitions {
+			event, ok := events[tran.Event]
+			if !ok {
+				event = &eventModel{
+					Name:   tran.Event,
+					GoName: "Event" + GoName(tran.Event),
+				}
+				if err := claim(event.GoName, tran.Event); err != nil {
+					return err
+				}
+				events[tran.Event] = event
+				m.Events = append(m.Events, event)
+			}
+			var handler *handlerModel
+			for _, h := range state.Handlers {
+				if h.Event == event {
+					handler = h
+				}
+			}
+			if handler == nil {
+				handler = &handlerModel{Event: event}
+				state.Handlers = append(state.Handlers, handler)
+			}
+			t := &transitionModel{Target: states[tran.Target]}
+			if tran.Guard != "" {
+				if t.Guard, err = lookup(guards, &m.Guards, tran.Guard); err != nil {
+					return err
+				}
+			}
+			if t.Actions, err = names(tran.Actions); err != nil {
+				return err
+			}
+			handler.Transitions = append(handler.Transitions, t)
+		}
+		for _, child := range def.States {
+			if err := resolve(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, def := range definition.States {
+		if err := resolve(def); err != nil {
+			return nil, err
+		}
+	}
+	init := definition.Initial
+	if init == "" {
+		init = definition.States[0].ID
+	}
+	m.Initial = states[init]
+	return m, nil
+}
+
+// execute() runs template with m, and formats the result as Go source.
+func execute(tmpl *template.Template, m interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, m); err != nil {
+		return nil, err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated codes: %v\n%s", err,
+			buf.String())
+	}
+	return source, nil
+}
+
+// quote() is used in templates to write Go string literals.
+func quote(s string) string {
+	return fmt.Sprintf("%q", s)
+}
+
+var funcs = template.FuncMap{
+	"quote": quote,
+}
@@ -0,0 +1,105 @@
+package codegen
+
+import (
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testYAML = `
+name: switch
+version: 3
+states:
+  - id: "off"
+    transitions:
+      - {event: toggle, target: "on"}
+  - id: "on"
+    entry: [light_on]
+    transitions:
+      - {event: toggle, target: "off", guard: allowed}
+`
+
+func TestGoName(t *testing.T) {
+	assert.Equal(t, "LockedQuiet", GoName("locked_quiet"))
+	assert.Equal(t, "S211", GoName("s211"))
+	assert.Equal(t, "X1st", GoName("1st"))
+}
+
+func TestGenerateHandlers(t *testing.T) {
+	definition, err := definition.Read(strings.NewReader(testYAML), definition.FormatYAML)
+	assert.Nil(t, err)
+	opts := &Options{Package: "light"}
+	states, err := GenerateStates(definition, opts)
+	assert.Nil(t, err)
+	assert.Contains(t, string(states), "type SwitchHSM struct {")
+	assert.Contains(t, string(states), "if m.Allowed(event) {")
+	assert.Contains(t, string(states), "sm.DefinitionVersion = 3")
+
+	handlers, err := GenerateHandlers(definition, opts, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, string(handlers), "func (self *SwitchHSM) LightOn(event hsm.Event) {")
+
+	// user codes are preserved, and only the new stubs are appended
+	edited := strings.Replace(string(handlers),
+		"func (self *SwitchHSM) LightOn(event hsm.Event) {\n",
+		"func (self *SwitchHSM) LightOn(event hsm.Event) {\n\tprintln(\"on\")\n", 1)
+	definition.States[0].Entry = []string{"light_off"}
+	regenerated, err := GenerateHandlers(definition, opts, []byte(edited))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(regenerated), edited))
+	assert.Contains(t, string(regenerated), "func (self *SwitchHSM) LightOff(event hsm.Event) {")
+	assert.Equal(t, 1, strings.Count(string(regenerated), "LightOn(event hsm.Event)"))
+}
+
+func TestGenerateConflicts(t *testing.T) {
+	definition := &hsm.Definition{
+		Name: "x",
+		States: []*hsm.StateDefinition{
+			{ID: "a-b"},
+			{ID: "a_b"},
+		},
+	}
+	_, err := GenerateStates(definition, &Options{Package: "x"})
+	assert.NotNil(t, err)
+	definition.States[1].ID = "c"
+	for _, name := range []string{
+		"dispatch", "warn", "snapshot2", "lookup_state",
+		"declare_transition", "definition_version", "extended_state",
+	} {
+		definition.States[1].Entry = []string{name}
+		_, err = GenerateStates(definition, &Options{Package: "x"})
+		assert.NotNil(t, err, name)
+	}
+	definition.States[1].Entry = []string{"light_on"}
+	_, err = GenerateStates(definition, &Options{Package: "x"})
+	assert.Nil(t, err)
+}
+
+func TestGenerateSwitch(t *testing.T) {
+	definition, err := definition.Read(strings.NewReader(testYAML), definition.FormatYAML)
+	assert.Nil(t, err)
+	opts := &Options{Package: "light"}
+	source, err := GenerateSwitch(definition, opts)
+	assert.Nil(t, err)
+	assert.Contains(t, string(source), "type SwitchSwitch struct {")
+	assert.Contains(t, string(source), "\tSwitchSwitchOff = iota\n")
+	// the HSM type is constructed rather than embedded zero valued
+	assert.Contains(t, string(source),
+		"return &SwitchSwitch{State: -1, actions: NewSwitchHSM()}")
+	assert.NotContains(t, string(source), "\tSwitchHSM\n")
+	assert.Contains(t, string(source), `			if self.actions.Allowed(event) {
+				// on -> off
+				self.State = SwitchSwitchOff
+				return
+			}`)
+	assert.Contains(t, string(source), `			// off -> on
+			self.actions.LightOn(switchSwitchEntry)
+			self.State = SwitchSwitchOn`)
+
+	test, err := GenerateSwitchTest(definition, opts)
+	assert.Nil(t, err)
+	assert.Contains(t, string(test),
+		"func TestSwitchSwitchEquivalence(t *testing.T) {")
+}
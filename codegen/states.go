@@ -0,0 +1,321 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"text/template"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// GenerateStates() generates the state types, state ID constants,
+// event types, constructors and the HSM type for definition.
+// The generated file should never be edited by hand, since it's overwritten
+// on every generation. Actions and guards are methods of the HSM type,
+// which are written by hand in the handlers file, see GenerateHandlers().
+func GenerateStates(definition *hsm.Definition, opts *Options) ([]byte, error) {
+	m, err := newModel(definition, opts)
+	if err != nil {
+		return nil, err
+	}
+	return execute(statesTemplate, m)
+}
+
+// GenerateHandlers() generates the handlers file for definition, which
+// contains the extended state data type and the methods for actions and
+// guards. It's the place for codes written by hand. If existing is not
+// nil, it's the content of the handlers file generated before, and only
+// the stubs missing in it are appended so that user codes are preserved.
+func GenerateHandlers(
+	definition *hsm.Definition, opts *Options, existing []byte) ([]byte, error) {
+
+	m, err := newModel(definition, opts)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return execute(handlersTemplate, m)
+	}
+	declared, err := declaredNames(existing)
+	if err != nil {
+		return nil, err
+	}
+	missing := &model{
+		Options:  m.Options,
+		HSMType:  m.HSMType,
+		DataType: m.DataType,
+	}
+	for _, action := range m.Actions {
+		if !declared[action.GoName] {
+			missing.Actions = append(missing.Actions, action)
+		}
+	}
+	for _, guard := range m.Guards {
+		if !declared[guard.GoName] {
+			missing.Guards = append(missing.Guards, guard)
+		}
+	}
+	var buf bytes.Buffer
+	buf.Write(existing)
+	if !declared[m.DataType] {
+		fmt.Fprintf(&buf, "\n// %s is the extended state data of %s.\n"+
+			"type %s struct {\n}\n", m.DataType, m.HSMType, m.DataType)
+	}
+	if err := stubsTemplate.Execute(&buf, missing); err != nil {
+		return nil, err
+	}
+	return formatSource(buf.Bytes())
+}
+
+// declaredNames() returns the names of all the types and methods
+// declared in Go source.
+func declaredNames(source []byte) (map[string]bool, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			names[d.Name.Name] = true
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if s, ok := spec.(*ast.TypeSpec); ok {
+					names[s.Name.Name] = true
+				}
+			}
+		}
+	}
+	return names, nil
+}
+
+func formatSource(source []byte) ([]byte, error) {
+	return format.Source(source)
+}
+
+var statesTemplate = template.Must(template.New("states").Funcs(funcs).Parse(
+	`// Code generated by hsmgen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// The IDs of all states.
+const (
+{{- range .States}}
+	State{{.GoName}}ID = {{quote .ID}}
+{{- end}}
+)
+{{if .Events}}
+// The event types, registered by their names.
+var (
+{{- range .Events}}
+	{{.GoName}} = hsm.InternEventType({{quote .Name}})
+{{- end}}
+)
+{{end}}
+// {{.HSMType}} is the state machine {{quote .Name}}.
+type {{.HSMType}} struct {
+	*hsm.StdHSM
+	{{.DataType}}
+}
+
+// New{{.HSMType}}() creates all the states and the state machine.
+// The returned state machine is not initialized.
+func New{{.HSMType}}() *{{.HSMType}} {
+	top := hsm.NewTop()
+	initial := hsm.NewInitial(top, State{{.Initial.GoName}}ID)
+{{- range .States}}
+	{{if .Initial}}{{.VarName}} := {{end}}New{{.GoName}}State({{if .Super}}{{.Super.VarName}}{{else}}top{{end}})
+{{- end}}
+	sm := &{{.HSMType}}{
+		StdHSM: hsm.NewStdHSM(hsm.HSMTypeStd, top, initial),
+	}
+{{- if .Version}}
+	sm.DefinitionVersion = {{.Version}}
+{{- end}}
+{{- range $state := .States}}
+{{- if .Initial}}
+	sm.DeclareTransition(State{{.GoName}}ID, hsm.EventInit, State{{.Initial.GoName}}ID)
+{{- end}}
+{{- range .Handlers}}
+{{- $event := .Event}}
+{{- range .Transitions}}
+	sm.DeclareTransition(State{{$state.GoName}}ID, {{$event.GoName}}, {{if .Target}}State{{.Target.GoName}}ID{{else}}""{{end}})
+{{- end}}
+{{- end}}
+{{- end}}
+	return sm
+}
+
+// Init() is part of interface HSM.
+func (self *{{.HSMType}}) Init() {
+	self.StdHSM.Init2(self, hsm.StdEvents[hsm.EventInit])
+}
+
+// Dispatch() is part of interface HSM.
+func (self *{{.HSMType}}) Dispatch(event hsm.Event) {
+	self.StdHSM.Dispatch2(self, event)
+}
+
+// DispatchContext() dispatches event with ctx, see hsm.ContextOf().
+func (self *{{.HSMType}}) DispatchContext(ctx context.Context, event hsm.Event) error {
+	return self.StdHSM.DispatchContext2(self, ctx, event)
+}
+
+// QTran() is part of interface HSM.
+func (self *{{.HSMType}}) QTran(targetStateID string) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranHSM(self, target)
+}
+
+// QTranOnEvent() is part of interface HSM.
+func (self *{{.HSMType}}) QTranOnEvent(targetStateID string, event hsm.Event) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranHSMOnEvent(self, target, event)
+}
+
+// QTranDyn() is part of interface HSM.
+func (self *{{.HSMType}}) QTranDyn(targetStateID string) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranDynHSM(self, target)
+}
+
+// QTranDynOnEvent() is part of interface HSM.
+func (self *{{.HSMType}}) QTranDynOnEvent(targetStateID string, event hsm.Event) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranDynHSMOnEvent(self, target, event)
+}
+
+// CurrentStateID() returns the ID of current state.
+func (self *{{.HSMType}}) CurrentStateID() string {
+	return self.StdHSM.State.ID()
+}
+
+// ExtendedState() is part of interface ExtendedState.
+func (self *{{.HSMType}}) ExtendedState() interface{} {
+	return &self.{{.DataType}}
+}
+
+// Snapshot() takes the snapshot of the current state and {{.DataType}}.
+func (self *{{.HSMType}}) Snapshot(codec hsm.Codec) (*hsm.Snapshot, error) {
+	return self.StdHSM.Snapshot2(self, codec)
+}
+
+// Restore() resumes the state machine from snapshot in place of Init().
+func (self *{{.HSMType}}) Restore(snapshot *hsm.Snapshot, codec hsm.Codec) error {
+	return self.StdHSM.Restore2(self, snapshot, codec)
+}
+{{range .States}}
+// {{.GoName}}State is the state {{quote .ID}}.
+type {{.GoName}}State struct {
+	*hsm.StateHead
+}
+
+func New{{.GoName}}State(super hsm.State) *{{.GoName}}State {
+	object := &{{.GoName}}State{
+		hsm.NewStateHead(super),
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (*{{.GoName}}State) ID() string {
+	return State{{.GoName}}ID
+}
+{{if .Initial}}
+func (self *{{.GoName}}State) Init(sm hsm.HSM, event hsm.Event) hsm.State {
+	sm.QInit(State{{.Initial.GoName}}ID)
+	return nil
+}
+{{end}}
+{{- if .Entry}}
+func (self *{{.GoName}}State) Entry(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*{{$.HSMType}})
+{{- range .Entry}}
+	m.{{.GoName}}(event)
+{{- end}}
+	return nil
+}
+{{end}}
+{{- if .Exit}}
+func (self *{{.GoName}}State) Exit(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*{{$.HSMType}})
+{{- range .Exit}}
+	m.{{.GoName}}(event)
+{{- end}}
+	return nil
+}
+{{end}}
+func (self *{{.GoName}}State) Handle(sm hsm.HSM, event hsm.Event) hsm.State {
+{{- if .Handlers}}
+{{- if .CallsHSM}}
+	m := sm.(*{{$.HSMType}})
+{{- end}}
+	switch event.Type() {
+{{- range .Handlers}}
+	case {{.Event.GoName}}:
+{{- range .Transitions}}
+{{- if .Guard}}
+		if m.{{.Guard.GoName}}(event) {
+{{- range .Actions}}
+			m.{{.GoName}}(event)
+{{- end}}
+{{- if .Target}}
+			sm.QTran(State{{.Target.GoName}}ID)
+{{- end}}
+			return nil
+		}
+{{- else}}
+{{- range .Actions}}
+		m.{{.GoName}}(event)
+{{- end}}
+{{- if .Target}}
+		sm.QTran(State{{.Target.GoName}}ID)
+{{- end}}
+		return nil
+{{- end}}
+{{- end}}
+{{- end}}
+	}
+{{- end}}
+	return self.Super()
+}
+{{end}}`))
+
+var handlersTemplate = template.Must(template.New("handlers").Funcs(funcs).Parse(
+	`// This file is written by hand. hsmgen creates it with stubs of
+// all the actions and guards, and appends stubs for the new ones
+// on regeneration, but never changes the existing codes.
+
+package {{.Package}}
+
+import hsm "github.com/hhkbp2/go-hsm"
+
+// {{.DataType}} is the extended state data of {{.HSMType}}.
+type {{.DataType}} struct {
+}
+` + stubs))
+
+var stubsTemplate = template.Must(template.New("stubs").Funcs(funcs).Parse(stubs))
+
+const stubs = `{{range .Actions}}
+// {{.GoName}}() is the action {{quote .Name}}.
+func (self *{{$.HSMType}}) {{.GoName}}(event hsm.Event) {
+}
+{{end}}
+{{- range .Guards}}
+// {{.GoName}}() is the guard {{quote .Name}}.
+func (self *{{$.HSMType}}) {{.GoName}}(event hsm.Event) bool {
+	return true
+}
+{{end}}`
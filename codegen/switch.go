@@ -0,0 +1,381 @@
+package codegen
+
+import (
+	"text/template"
+	"unicode"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// switchModel is the data which the switch templates generate codes from.
+type switchModel struct {
+	*model
+	// The type name of generated switch machine
+	SwitchType string
+	// The leaf states, which could be current
+	Leaves []*leafModel
+	// The entry actions run by Init() in order
+	InitEntry []*nameModel
+	// The leaf state after Init()
+	InitTarget *stateModel
+}
+
+// Const() returns the name of the integer constant of state.
+func (self *switchModel) Const(state *stateModel) string {
+	return self.SwitchType + state.GoName
+}
+
+// EventVar() returns the name of the variable of the standard event kind,
+// "Entry" or "Exit", passed to the entry and exit actions.
+func (self *switchModel) EventVar(kind string) string {
+	r := []rune(self.SwitchType)
+	return string(unicode.ToLower(r[0])) + string(r[1:]) + kind
+}
+
+// SuperIndex() returns the index of the super state of state, -1 for top.
+func (self *switchModel) SuperIndex(state *stateModel) int {
+	if state.Super == nil {
+		return -1
+	}
+	return state.Super.Index
+}
+
+type leafModel struct {
+	State *stateModel
+	// The events handled by this state or its super states
+	Cases []*caseModel
+}
+
+type caseModel struct {
+	Event *eventModel
+	// The transitions to try in order
+	Candidates []*candidateModel
+}
+
+// candidateModel is a transition from a leaf state, with the exit
+// and entry actions on its path resolved.
+type candidateModel struct {
+	// The state declaring this transition
+	Source  *stateModel
+	Guard   *nameModel
+	Actions []*nameModel
+	Exit    []*nameModel
+	Entry   []*nameModel
+	// The target declared, nil for internal transition
+	Target *stateModel
+	// The leaf state after transition, nil for internal transition
+	Leaf *stateModel
+	// The model generated from
+	Switch *switchModel
+}
+
+// GenerateSwitch() generates a state machine type for definition which
+// dispatches events by switch statements on integer state constants,
+// with the exit and entry actions of every transition inlined. It calls
+// the same actions and guards on an instance of the HSM type generated by
+// GenerateStates(), but never walks the hierarchy of hsm.State at runtime.
+func GenerateSwitch(definition *hsm.Definition, opts *Options) ([]byte, error) {
+	m, err := newSwitchModel(definition, opts)
+	if err != nil {
+		return nil, err
+	}
+	return execute(switchTemplate, m)
+}
+
+// GenerateSwitchTest() generates the test which dispatches random events
+// to the types generated by GenerateStates() and GenerateSwitch() side
+// by side, and checks that they are always equivalent.
+func GenerateSwitchTest(definition *hsm.Definition, opts *Options) ([]byte, error) {
+	m, err := newSwitchModel(definition, opts)
+	if err != nil {
+		return nil, err
+	}
+	return execute(switchTestTemplate, m)
+}
+
+// newSwitchModel() builds the model for switch templates, resolving
+// the transitions of all leaf states like hsm.Flatten().
+func newSwitchModel(definition *hsm.Definition, opts *Options) (*switchModel, error) {
+	m, err := newModel(definition, opts)
+	if err != nil {
+		return nil, err
+	}
+	sm := &switchModel{
+		model:      m,
+		SwitchType: GoName(m.Name) + "Switch",
+	}
+	sm.InitEntry, sm.InitTarget = enterPath(nil, m.Initial)
+	for _, state := range m.States {
+		if state.Initial != nil {
+			continue
+		}
+		leaf := &leafModel{State: state}
+		for _, event := range m.Events {
+			if candidates := candidatesOf(state, event); len(candidates) != 0 {
+				for _, candidate := range candidates {
+					candidate.Switch = sm
+				}
+				leaf.Cases = append(leaf.Cases, &caseModel{
+					Event:      event,
+					Candidates: candidates,
+				})
+			}
+		}
+		sm.Leaves = append(sm.Leaves, leaf)
+	}
+	return sm, nil
+}
+
+// candidatesOf() returns the transitions to try on event from leaf,
+// which are declared in leaf and then its super states.
+func candidatesOf(leaf *stateModel, event *eventModel) []*candidateModel {
+	var candidates []*candidateModel
+	var exit []*nameModel
+	for s := leaf; s != nil; s = s.Super {
+		for _, handler := range s.Handlers {
+			if handler.Event != event {
+				continue
+			}
+			for _, tran := range handler.Transitions {
+				candidate := &candidateModel{
+					Source:  s,
+					Guard:   tran.Guard,
+					Actions: tran.Actions,
+				}
+				if tran.Target != nil {
+					candidate.Target = tran.Target
+					candidate.Exit, candidate.Entry, candidate.Leaf =
+						transferPath(exit, s, tran.Target)
+				}
+				candidates = append(candidates, candidate)
+				if tran.Guard == nil {
+					// the transitions after are never taken
+					return candidates
+				}
+			}
+		}
+		exit = append(exit[:len(exit):len(exit)], s.Exit...)
+	}
+	return candidates
+}
+
+// depthOf() returns the depth of state, 0 for top which is nil.
+func depthOf(state *stateModel) int {
+	depth := 0
+	for ; state != nil; state = state.Super {
+		depth++
+	}
+	return depth
+}
+
+// transferPath() resolves the transfer from source to target after
+// the states below source are exited by actions exit, like QTranDyn().
+// It returns the exit and entry actions, and the leaf state at last.
+func transferPath(exit []*nameModel, source, target *stateModel) (
+	[]*nameModel, []*nameModel, *stateModel) {
+
+	exit = append([]*nameModel(nil), exit...)
+	if source == target { // transition to self
+		entry, leaf := enterPath(source.Super, target)
+		return append(exit, source.Exit...), entry, leaf
+	}
+	s, t := source, target
+	for depthOf(t) > depthOf(s) {
+		t = t.Super
+	}
+	for depthOf(s) > depthOf(t) {
+		exit = append(exit, s.Exit...)
+		s = s.Super
+	}
+	for s != t {
+		exit = append(exit, s.Exit...)
+		s, t = s.Super, t.Super
+	}
+	entry, leaf := enterPath(s, target)
+	return exit, entry, leaf
+}
+
+// enterPath() returns the entry actions of the states from below
+// the ancestor lca down to target, and then along the initial transitions
+// from target, and the leaf state at last.
+func enterPath(lca, target *stateModel) ([]*nameModel, *stateModel) {
+	var path []*stateModel
+	for s := target; s != lca; s = s.Super {
+		path = append(path, s)
+	}
+	var entry []*nameModel
+	for i := len(path) - 1; i >= 0; i-- {
+		entry = append(entry, path[i].Entry...)
+	}
+	for target.Initial != nil {
+		target = target.Initial
+		entry = append(entry, target.Entry...)
+	}
+	return entry, target
+}
+
+var switchTemplate = template.Must(template.New("switch").Funcs(funcs).Parse(
+	`// Code generated by hsmgen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// The indexes of all states in {{.SwitchType}}.
+const (
+{{- range $i, $state := .States}}
+	{{$.Const $state}}{{if eq $i 0}} = iota{{end}}
+{{- end}}
+)
+
+// The IDs and the indexes of super states of all states, by their indexes.
+var (
+	{{.SwitchType}}IDs = [...]string{
+{{- range .States}}
+		State{{.GoName}}ID,
+{{- end}}
+	}
+	{{.SwitchType}}Supers = [...]int{
+{{- range .States}}
+		{{$.SuperIndex .}},
+{{- end}}
+	}
+	// the events passed to entry and exit actions like hsm.StdHSM
+	{{.EventVar "Entry"}} hsm.Event = hsm.StdEvents[hsm.EventEntry]
+	{{.EventVar "Exit"}}  hsm.Event = hsm.StdEvents[hsm.EventExit]
+)
+
+// {{.SwitchType}} is the state machine {{quote .Name}} which dispatches
+// events by switch statements, with the transitions resolved at generation.
+// The actions and guards are called on a {{.HSMType}}, which holds
+// the extended state but is never initialized itself.
+type {{.SwitchType}} struct {
+	// The index of current state, which is always a leaf, -1 before Init()
+	State int
+	// the receiver of the actions and guards
+	actions *{{.HSMType}}
+}
+
+// New{{.SwitchType}}() creates the state machine, which is not initialized.
+func New{{.SwitchType}}() *{{.SwitchType}} {
+	return &{{.SwitchType}}{State: -1, actions: New{{.HSMType}}()}
+}
+
+// Data() returns the extended state of the actions and guards.
+func (self *{{.SwitchType}}) Data() *{{.DataType}} {
+	return &self.actions.{{.DataType}}
+}
+
+// Init() enters the initial states.
+func (self *{{.SwitchType}}) Init() {
+{{- range .InitEntry}}
+	self.actions.{{.GoName}}({{$.EventVar "Entry"}})
+{{- end}}
+	self.State = {{.Const .InitTarget}}
+}
+
+// Dispatch() takes the first transition of event from current state whose
+// guard holds, and ignores the event if there is none.
+func (self *{{.SwitchType}}) Dispatch(event hsm.Event) {
+	switch self.State {
+{{- range .Leaves}}
+{{- if .Cases}}
+	case {{$.Const .State}}:
+		switch event.Type() {
+{{- range .Cases}}
+		case {{.Event.GoName}}:
+{{- range .Candidates}}
+{{- if .Guard}}
+			if self.actions.{{.Guard.GoName}}(event) {
+{{- template "transition" .}}
+				return
+			}
+{{- else}}
+{{- template "transition" .}}
+{{- end}}
+{{- end}}
+{{- end}}
+		}
+{{- end}}
+{{- end}}
+	}
+}
+
+// CurrentStateID() returns the ID of current state.
+func (self *{{.SwitchType}}) CurrentStateID() string {
+	return {{.SwitchType}}IDs[self.State]
+}
+
+// IsIn() tests whether the state stateID is current state or any of
+// its super states.
+func (self *{{.SwitchType}}) IsIn(stateID string) bool {
+	for s := self.State; s >= 0; s = {{.SwitchType}}Supers[s] {
+		if {{.SwitchType}}IDs[s] == stateID {
+			return true
+		}
+	}
+	return false
+}
+{{define "transition"}}
+			// {{.Source.ID}}{{if .Target}} -> {{.Target.ID}}{{else}}: internal transition{{end}}
+{{- range .Actions}}
+			self.actions.{{.GoName}}(event)
+{{- end}}
+{{- range .Exit}}
+			self.actions.{{.GoName}}({{$.Switch.EventVar "Exit"}})
+{{- end}}
+{{- range .Entry}}
+			self.actions.{{.GoName}}({{$.Switch.EventVar "Entry"}})
+{{- end}}
+{{- if .Leaf}}
+			self.State = {{.Switch.Const .Leaf}}
+{{- end}}
+{{- end}}`))
+
+var switchTestTemplate = template.Must(template.New("switchTest").Funcs(funcs).Parse(
+	`// Code generated by hsmgen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// Test{{.SwitchType}}Equivalence() dispatches random events to {{.HSMType}}
+// and {{.SwitchType}} side by side, and checks that they are always in
+// the same state with the same extended state.
+func Test{{.SwitchType}}Equivalence(t *testing.T) {
+	sm := New{{.HSMType}}()
+	fast := New{{.SwitchType}}()
+	sm.Init()
+	fast.Init()
+	events := []hsm.EventType{
+{{- range .Events}}
+		{{.GoName}},
+{{- end}}
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; ; i++ {
+		if sm.CurrentStateID() != fast.CurrentStateID() {
+			t.Fatalf("after %d events: %s by {{.HSMType}}, %s by {{.SwitchType}}",
+				i, sm.CurrentStateID(), fast.CurrentStateID())
+		}
+		if !reflect.DeepEqual(sm.{{.DataType}}, *fast.Data()) {
+			t.Fatalf("after %d events: %+v by {{.HSMType}}, %+v by {{.SwitchType}}",
+				i, sm.{{.DataType}}, *fast.Data())
+		}
+		if i == 10000 || len(events) == 0 {
+			break
+		}
+		event := hsm.StdEventOf(events[random.Intn(len(events))])
+		sm.Dispatch(event)
+		fast.Dispatch(event)
+	}
+}
+`))
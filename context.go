@@ -0,0 +1,87 @@
+package hsm
+
+import (
+	"context"
+)
+
+// DispatchContext() is a helper function to dispatch event with ctx
+// to StdHSM itself.
+func (self *StdHSM) DispatchContext(ctx context.Context, event Event) error {
+	return self.DispatchContext2(self, ctx, event)
+}
+
+// DispatchContext2() dispatches event to the concrete HSM like Dispatch2(),
+// and makes ctx available to all the callbacks of states by ContextOf()
+// until the events posted are all dispatched. When ctx is done, nothing
+// more is dispatched, the events left in Queue are dropped and
+// the error of ctx is returned. The step of an event which has started
+// is always run to completion, since the states could not be left
+// half way in a transition. Called in the callbacks of states, it only
+// posts event like Post(), to be dispatched after the current one.
+func (self *StdHSM) DispatchContext2(
+	hsm HSM, ctx context.Context, event Event) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	self.Post(event)
+	if self.draining {
+		return nil
+	}
+	return self.drain(hsm, ctx)
+}
+
+// drain() dispatches the events in Queue with ctx one by one.
+func (self *StdHSM) drain(hsm HSM, ctx context.Context) error {
+	previous := self.Context
+	self.Context = ctx
+	self.draining = true
+	defer func() {
+		self.Context = previous
+		self.draining = false
+	}()
+	// the backing array of Queue is reused to dispatch without allocation
+	defer func() {
+		for i := range self.Queue {
+			self.Queue[i] = nil
+		}
+		self.Queue = self.Queue[:0]
+	}()
+	for i := 0; i < len(self.Queue); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		event := self.Queue[i]
+		self.Queue[i] = nil
+		self.dispatch(hsm, event)
+	}
+	return nil
+}
+
+// Post() queues event to be dispatched after the event being dispatched,
+// in the same context. It's called in the callbacks of states to
+// dispatch events to the state machine itself.
+func (self *StdHSM) Post(event Event) {
+	self.Queue = append(self.Queue, event)
+}
+
+// ContextOf() returns the context of the event being dispatched to hsm,
+// or context.Background() if there is none.
+func ContextOf(hsm HSM) context.Context {
+	if c, ok := hsm.(contextual); ok {
+		if ctx := c.context(); ctx != nil {
+			return ctx
+		}
+	}
+	return context.Background()
+}
+
+// contextual is implemented by StdHSM, and so by every HSM which
+// embeds StdHSM, for ContextOf().
+type contextual interface {
+	context() context.Context
+}
+
+func (self *StdHSM) context() context.Context {
+	return self.Context
+}
@@ -0,0 +1,134 @@
+package hsm
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type testContextKey struct{}
+
+// testPostingState posts event B on event A, and logs the value in
+// context on every event handled.
+type testPostingState struct {
+	*StateHead
+	log    *[]string
+	cancel func()
+}
+
+func (self *testPostingState) ID() string {
+	return "posting"
+}
+
+func (self *testPostingState) Handle(sm HSM, event Event) State {
+	value, _ := ContextOf(sm).Value(testContextKey{}).(string)
+	*self.log = append(*self.log, EventName(event.Type())+":"+value)
+	switch event.Type() {
+	case testEventA:
+		sm.(*StdHSM).Post(NewStdEvent(testEventB))
+		sm.(*StdHSM).Post(NewStdEvent(testEventC))
+		return nil
+	case testEventB:
+		if self.cancel != nil {
+			self.cancel()
+		}
+		return nil
+	case testEventC:
+		return nil
+	}
+	return self.Super()
+}
+
+func newTestPostingHSM(log *[]string) (*StdHSM, *testPostingState) {
+	top := NewTop()
+	initial := NewInitial(top, "posting")
+	state := &testPostingState{StateHead: NewStateHead(top), log: log}
+	top.AddChild(state)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.Init()
+	return sm, state
+}
+
+func TestDispatchContext(t *testing.T) {
+	var log []string
+	sm, _ := newTestPostingHSM(&log)
+	var traced []string
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		value, _ := record.Context.Value(testContextKey{}).(string)
+		traced = append(traced, record.String()+":"+value)
+	}))
+	ctx := context.WithValue(context.Background(), testContextKey{}, "trace-1")
+	assert.Nil(t, sm.DispatchContext(ctx, NewStdEvent(testEventA)))
+	assert.Equal(t, []string{"A:trace-1", "B:trace-1", "C:trace-1"}, log)
+	assert.Equal(t, []string{
+		"posting-Handle(A):trace-1",
+		"posting-Handle(B):trace-1",
+		"posting-Handle(C):trace-1"}, traced)
+	assert.Nil(t, sm.Context)
+
+	// posted events are dispatched by Dispatch() as well
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, []string{"A:", "B:", "C:"}, log)
+}
+
+func TestDispatchContextCancel(t *testing.T) {
+	var log []string
+	sm, state := newTestPostingHSM(&log)
+	ctx, cancel := context.WithCancel(context.Background())
+	state.cancel = cancel
+	// the posted C is dropped after B cancels the context
+	assert.Equal(t, context.Canceled,
+		sm.DispatchContext(ctx, NewStdEvent(testEventA)))
+	assert.Equal(t, []string{"A:", "B:"}, log)
+	assert.Equal(t, 0, len(sm.Queue))
+
+	log = nil
+	assert.Equal(t, context.Canceled,
+		sm.DispatchContext(ctx, NewStdEvent(testEventC)))
+	assert.Equal(t, 0, len(log))
+}
+
+// testDispatchingState dispatches event on entry, as a callback which
+// doesn't know it's run in dispatching.
+type testDispatchingState struct {
+	*testState
+	event EventType
+	err   error
+}
+
+func (self *testDispatchingState) Entry(sm HSM, event Event) State {
+	self.testState.Entry(sm, event)
+	self.err = sm.(*StdHSM).DispatchContext(
+		context.Background(), NewStdEvent(self.event))
+	return nil
+}
+
+func TestDispatchReentrant(t *testing.T) {
+	var log []string
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	newTestState(top, "s1", "", map[EventType]string{testEventA: "s2"}, &log)
+	s2 := &testDispatchingState{
+		testState: &testState{
+			StateHead: NewStateHead(top), id: "s2", log: &log,
+			trans: map[EventType]string{testEventB: "s3"}},
+		event: testEventB,
+	}
+	top.AddChild(s2)
+	newTestState(top, "s3", "", map[EventType]string{testEventC: "s2"}, &log)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.Init()
+	log = nil
+	// B is dispatched after the transition on A completes
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, []string{"s1-Exit", "s2-Entry", "s2-Exit", "s3-Entry"}, log)
+	assert.Equal(t, "s3", sm.GetState().ID())
+	assert.Equal(t, 0, len(sm.Queue))
+	assert.Nil(t, s2.err)
+	// and in the cached transition chain as well
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventC))
+	assert.Equal(t, []string{"s3-Exit", "s2-Entry", "s2-Exit", "s3-Entry"}, log)
+	assert.Equal(t, "s3", sm.GetState().ID())
+}
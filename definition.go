@@ -0,0 +1,521 @@
+package hsm
+
+import (
+	"fmt"
+)
+
+// Definition describes the structure of a state machine as data,
+// so that a state machine could be loaded from documents
+// rather than written in Go codes.
+type Definition struct {
+	// The name of this state machine
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// The version of this definition, which is saved in snapshots
+	// to migrate them when states are changed, see Migration
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+	// The initial state, the first state is used if empty
+	Initial string `json:"initial,omitempty" yaml:"initial,omitempty"`
+	// The states under the top state
+	States []*StateDefinition `json:"states" yaml:"states"`
+}
+
+// StateDefinition describes a state in Definition.
+type StateDefinition struct {
+	// The ID of this state
+	ID string `json:"id" yaml:"id"`
+	// The initial child state, the first child is used if empty
+	Initial string `json:"initial,omitempty" yaml:"initial,omitempty"`
+	// Whether this is a final state
+	Final bool `json:"final,omitempty" yaml:"final,omitempty"`
+	// "shallow" or "deep" if this is a history pseudo-state of its parent,
+	// whose Initial is the state to go to when there is no history yet,
+	// the initial state of its parent if empty
+	History string `json:"history,omitempty" yaml:"history,omitempty"`
+	// The names of actions to run on entry
+	Entry []string `json:"entry,omitempty" yaml:"entry,omitempty"`
+	// The names of actions to run on exit
+	Exit []string `json:"exit,omitempty" yaml:"exit,omitempty"`
+	// The transitions handled by this state
+	Transitions []*TransitionDefinition `json:"transitions,omitempty" yaml:"transitions,omitempty"`
+	// The children states
+	States []*StateDefinition `json:"states,omitempty" yaml:"states,omitempty"`
+}
+
+// TransitionDefinition describes a transition in StateDefinition.
+type TransitionDefinition struct {
+	// The name of the event that triggers this transition
+	Event string `json:"event" yaml:"event"`
+	// The target state, empty for internal transition
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	// The name of guard which must hold to take this transition
+	Guard string `json:"guard,omitempty" yaml:"guard,omitempty"`
+	// The names of actions to run when this transition is taken
+	Actions []string `json:"actions,omitempty" yaml:"actions,omitempty"`
+}
+
+// Action is the Go function bound to an action name in Definition.
+type Action func(sm HSM, event Event)
+
+// Guard is the Go function bound to a guard name in Definition.
+type Guard func(sm HSM, event Event) bool
+
+// Bindings resolves the names of actions and guards in Definition.
+type Bindings struct {
+	Actions map[string]Action
+	Guards  map[string]Guard
+}
+
+// NewBindings() is the constructor for Bindings.
+func NewBindings() *Bindings {
+	return &Bindings{
+		Actions: make(map[string]Action),
+		Guards:  make(map[string]Guard),
+	}
+}
+
+// BindAction() binds action to name. It returns self for chaining.
+func (self *Bindings) BindAction(name string, action Action) *Bindings {
+	AssertFalse(self.Actions[name] != nil)
+	self.Actions[name] = action
+	return self
+}
+
+// BindGuard() binds guard to name. It returns self for chaining.
+func (self *Bindings) BindGuard(name string, guard Guard) *Bindings {
+	AssertFalse(self.Guards[name] != nil)
+	self.Guards[name] = guard
+	return self
+}
+
+// Validate() checks the structure of definition, and whether all the
+// actions and guards referred could be resolved in bindings.
+// Only the structure is checked if bindings is nil.
+func (self *Definition) Validate(bindings *Bindings) error {
+	if len(self.States) == 0 {
+		return fmt.Errorf("definition %q has no state", self.Name)
+	}
+	if self.Version < 0 {
+		return fmt.Errorf("definition %q has negative version", self.Name)
+	}
+	states := make(map[string]*StateDefinition)
+	var check func(state *StateDefinition) error
+	check = func(state *StateDefinition) error {
+		switch state.ID {
+		case "":
+			return fmt.Errorf("state without id")
+		case TopStateID, InitialStateID:
+			return fmt.Errorf("state id %q is reserved", state.ID)
+		}
+		if _, ok := states[state.ID]; ok {
+			return fmt.Errorf("duplicate state %q", state.ID)
+		}
+		states[state.ID] = state
+		if state.Final && len(state.States) != 0 {
+			return fmt.Errorf("final state %q has children", state.ID)
+		}
+		if state.History != "" {
+			return checkHistory(state)
+		}
+		if state.Initial != "" {
+			initial := findStateDefinition(state.States, state.Initial)
+			if initial == nil {
+				return fmt.Errorf("initial %q of state %q is not its child",
+					state.Initial, state.ID)
+			}
+			if initial.History != "" {
+				return fmt.Errorf("initial %q of state %q is history",
+					state.Initial, state.ID)
+			}
+		}
+		names := append(append([]string{}, state.Entry...), state.Exit...)
+		for _, tran := range state.Transitions {
+			if tran.Event == "" {
+				return fmt.Errorf("transition without event in state %q",
+					state.ID)
+			}
+			if IsReservedEventName(tran.Event) {
+				return fmt.Errorf("event %q in state %q is reserved",
+					tran.Event, state.ID)
+			}
+			if tran.Guard != "" && bindings != nil &&
+				bindings.Guards[tran.Guard] == nil {
+				return fmt.Errorf("unbound guard %q in state %q",
+					tran.Guard, state.ID)
+			}
+			names = append(names, tran.Actions...)
+		}
+		for _, name := range names {
+			if bindings != nil && bindings.Actions[name] == nil {
+				return fmt.Errorf("unbound action %q in state %q",
+					name, state.ID)
+			}
+		}
+		for _, child := range state.States {
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, state := range self.States {
+		if state.History != "" {
+			return fmt.Errorf("history state %q has no parent", state.ID)
+		}
+		if err := check(state); err != nil {
+			return err
+		}
+	}
+	if self.Initial != "" && findStateDefinition(self.States, self.Initial) == nil {
+		return fmt.Errorf("initial %q is not a top level state", self.Initial)
+	}
+	for _, state := range states {
+		for _, tran := range state.Transitions {
+			if _, ok := states[tran.Target]; tran.Target != "" && !ok {
+				return fmt.Errorf("transition from %q to unknown state %q",
+					state.ID, tran.Target)
+			}
+		}
+	}
+	// the default of history must be below its parent
+	var checkDefault func(state *StateDefinition) error
+	checkDefault = func(state *StateDefinition) error {
+		for _, child := range state.States {
+			if child.History != "" && initialOf(state.States, "") == "" {
+				return fmt.Errorf("history %q has no default", child.ID)
+			}
+			if child.History != "" && child.Initial != "" {
+				target := states[child.Initial]
+				if target == nil || target.History != "" ||
+					!isDescendantDefinition(state, child.Initial) {
+					return fmt.Errorf("default %q of history %q is not below %q",
+						child.Initial, child.ID, state.ID)
+				}
+			}
+			if err := checkDefault(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, state := range self.States {
+		if err := checkDefault(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The kinds of history pseudo-states in StateDefinition.History.
+const (
+	HistoryShallow = "shallow"
+	HistoryDeep    = "deep"
+)
+
+// checkHistory() checks the history pseudo-state, which is only a target
+// of transitions.
+func checkHistory(state *StateDefinition) error {
+	switch {
+	case state.History != HistoryShallow && state.History != HistoryDeep:
+		return fmt.Errorf("history state %q is neither %q nor %q",
+			state.ID, HistoryShallow, HistoryDeep)
+	case state.Final:
+		return fmt.Errorf("history state %q is final", state.ID)
+	case len(state.States) != 0:
+		return fmt.Errorf("history state %q has children", state.ID)
+	case len(state.Transitions) != 0 || len(state.Entry) != 0 ||
+		len(state.Exit) != 0:
+		return fmt.Errorf("history state %q has actions or transitions",
+			state.ID)
+	}
+	return nil
+}
+
+// isDescendantDefinition() tests whether the state id is below state.
+func isDescendantDefinition(state *StateDefinition, id string) bool {
+	for _, child := range state.States {
+		if child.ID == id || isDescendantDefinition(child, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActionNames() returns the names of all actions referred in definition,
+// in the order they first appear.
+func (self *Definition) ActionNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	self.walk(func(state *StateDefinition) {
+		add(state.Entry)
+		add(state.Exit)
+		for _, tran := range state.Transitions {
+			add(tran.Actions)
+		}
+	})
+	return names
+}
+
+// GuardNames() returns the names of all guards referred in definition,
+// in the order they first appear.
+func (self *Definition) GuardNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	self.walk(func(state *StateDefinition) {
+		for _, tran := range state.Transitions {
+			if tran.Guard != "" && !seen[tran.Guard] {
+				seen[tran.Guard] = true
+				names = append(names, tran.Guard)
+			}
+		}
+	})
+	return names
+}
+
+// walk() calls f on every state in definition, in depth first order.
+func (self *Definition) walk(f func(state *StateDefinition)) {
+	var walk func(state *StateDefinition)
+	walk = func(state *StateDefinition) {
+		f(state)
+		for _, child := range state.States {
+			walk(child)
+		}
+	}
+	for _, state := range self.States {
+		walk(state)
+	}
+}
+
+// findStateDefinition() searches the state with id in states.
+// It doesn't search recursively.
+func findStateDefinition(
+	states []*StateDefinition, id string) *StateDefinition {
+
+	for _, state := range states {
+		if state.ID == id {
+			return state
+		}
+	}
+	return nil
+}
+
+// initialOf() returns the initial state among states, which is
+// the one named initial, or the first state other than history
+// if initial is empty.
+func initialOf(states []*StateDefinition, initial string) string {
+	if initial != "" {
+		return initial
+	}
+	for _, state := range states {
+		if state.History == "" {
+			return state.ID
+		}
+	}
+	return ""
+}
+
+// Build() creates the state machine described by definition.
+// The actions and guards are resolved in bindings.
+// The returned state machine is not initialized, call Init() on it
+// before dispatching events.
+func Build(definition *Definition, bindings *Bindings) (*StdHSM, error) {
+	if bindings == nil {
+		bindings = &Bindings{}
+	}
+	if err := definition.Validate(bindings); err != nil {
+		return nil, err
+	}
+	top := NewTop()
+	initial := NewInitial(top, initialOf(definition.States, definition.Initial))
+	var build func(super State, state *StateDefinition)
+	build = func(super State, state *StateDefinition) {
+		s := newDefState(super, state, bindings)
+		for _, child := range state.States {
+			if child.History != "" {
+				NewHistory(s, child.ID, child.History == HistoryDeep,
+					initialOf(state.States, child.Initial))
+				continue
+			}
+			build(s, child)
+		}
+	}
+	for _, state := range definition.States {
+		build(top, state)
+	}
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.DefinitionVersion = definition.Version
+	var declare func(state *StateDefinition)
+	declare = func(state *StateDefinition) {
+		if state.History != "" {
+			return
+		}
+		if init := initialOf(state.States, state.Initial); init != "" {
+			sm.DeclareTransition(state.ID, EventInit, init)
+		}
+		for _, tran := range state.Transitions {
+			sm.DeclareTransition(
+				state.ID, InternEventType(tran.Event), tran.Target)
+		}
+		for _, child := range state.States {
+			declare(child)
+		}
+	}
+	for _, state := range definition.States {
+		declare(state)
+	}
+	return sm, nil
+}
+
+// defTransition is a TransitionDefinition with names resolved.
+type defTransition struct {
+	def     *TransitionDefinition
+	event   EventType
+	guard   Guard
+	actions []Action
+}
+
+// defState is the State built from StateDefinition.
+type defState struct {
+	*StateHead
+	def         *StateDefinition
+	initial     string
+	entry       []Action
+	exit        []Action
+	transitions []*defTransition
+}
+
+func newDefState(
+	super State, def *StateDefinition, bindings *Bindings) *defState {
+
+	resolve := func(names []string) []Action {
+		actions := make([]Action, 0, len(names))
+		for _, name := range names {
+			actions = append(actions, bindings.Actions[name])
+		}
+		return actions
+	}
+	object := &defState{
+		StateHead: NewStateHead(super),
+		def:       def,
+		initial:   initialOf(def.States, def.Initial),
+		entry:     resolve(def.Entry),
+		exit:      resolve(def.Exit),
+	}
+	for _, tran := range def.Transitions {
+		object.transitions = append(object.transitions, &defTransition{
+			def:     tran,
+			event:   InternEventType(tran.Event),
+			guard:   bindings.Guards[tran.Guard],
+			actions: resolve(tran.Actions),
+		})
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (self *defState) ID() string {
+	return self.def.ID
+}
+
+func (self *defState) Init(sm HSM, event Event) State {
+	if self.initial == "" {
+		return self.Super()
+	}
+	sm.QInit(self.initial)
+	return nil
+}
+
+func (self *defState) Entry(sm HSM, event Event) State {
+	runActions(self.entry, sm, event)
+	return nil
+}
+
+func (self *defState) Exit(sm HSM, event Event) State {
+	runActions(self.exit, sm, event)
+	return nil
+}
+
+// Handle() takes the first transition whose event matches and whose guard
+// holds. Like the handlers written in Go, the actions of transition run
+// before the exit actions of the transition.
+func (self *defState) Handle(sm HSM, event Event) State {
+	for _, tran := range self.transitions {
+		if tran.event != event.Type() {
+			continue
+		}
+		if tran.guard != nil && !tran.guard(sm, event) {
+			continue
+		}
+		runActions(tran.actions, sm, event)
+		if tran.def.Target != "" {
+			sm.QTran(tran.def.Target)
+		}
+		return nil
+	}
+	return self.Super()
+}
+
+func runActions(actions []Action, sm HSM, event Event) {
+	for _, action := range actions {
+		action(sm, event)
+	}
+}
+
+// DefinitionOf() describes the structure of state machine sm as Definition.
+// For states built from Definition, the original StateDefinition is used.
+// For states written in Go, the declared transitions are used and
+// there are no actions or guards.
+func DefinitionOf(sm *StdHSM) *Definition {
+	var describe func(state State) *StateDefinition
+	describe = func(state State) *StateDefinition {
+		if s, ok := state.(*defState); ok {
+			return s.def
+		}
+		if h, ok := state.(*History); ok {
+			def := &StateDefinition{
+				ID:      h.ID(),
+				History: HistoryShallow,
+				Initial: h.DefaultStateID,
+			}
+			if h.Deep {
+				def.History = HistoryDeep
+			}
+			return def
+		}
+		def := &StateDefinition{
+			ID:    state.ID(),
+			Final: isFinal(state),
+		}
+		for _, tran := range sm.TransitionsFrom(state.ID()) {
+			if tran.Event == EventInit {
+				def.Initial = tran.Target
+				continue
+			}
+			def.Transitions = append(def.Transitions, &TransitionDefinition{
+				Event:  EventName(tran.Event),
+				Target: tran.Target,
+			})
+		}
+		for _, child := range state.Children() {
+			def.States = append(def.States, describe(child))
+		}
+		return def
+	}
+	definition := &Definition{
+		Version: sm.DefinitionVersion,
+		Initial: sm.InitialOf(TopStateID),
+	}
+	for _, child := range sm.StateTable[TopStateID].Children() {
+		if child.ID() != InitialStateID {
+			definition.States = append(definition.States, describe(child))
+		}
+	}
+	return definition
+}
@@ -0,0 +1,159 @@
+// Package definition reads and writes the definitions of state machines
+// in JSON, YAML and SCXML documents, so that the core package hsm doesn't
+// depend on any document format but SCXML. JSON and YAML documents are
+// validated against the schema in definition.schema.json.
+package definition
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"gopkg.in/yaml.v3"
+)
+
+// The formats of definition documents.
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatSCXML = "scxml"
+)
+
+// Read() reads the definition document of format from r. JSON and YAML
+// documents are validated against the schema, and the definition read
+// is checked by Validate() without bindings, so that only the structure
+// is validated.
+func Read(r io.Reader, format string) (*hsm.Definition, error) {
+	definition := &hsm.Definition{}
+	switch format {
+	case FormatJSON:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		var document interface{}
+		if err := json.Unmarshal(data, &document); err != nil {
+			return nil, err
+		}
+		if err := ValidateSchema(document); err != nil {
+			return nil, err
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(definition); err != nil {
+			return nil, err
+		}
+	case FormatYAML:
+		var node yaml.Node
+		if err := yaml.NewDecoder(r).Decode(&node); err != nil {
+			return nil, err
+		}
+		var document interface{}
+		if err := node.Decode(&document); err != nil {
+			return nil, err
+		}
+		if err := ValidateSchema(document); err != nil {
+			return nil, err
+		}
+		if err := node.Decode(definition); err != nil {
+			return nil, err
+		}
+	case FormatSCXML:
+		var err error
+		if definition, err = hsm.ReadSCXML(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown definition format %q", format)
+	}
+	if err := definition.Validate(nil); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// Write() writes definition to w in format.
+func Write(definition *hsm.Definition, w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(definition, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatYAML:
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(definition); err != nil {
+			return err
+		}
+		if err := encoder.Close(); err != nil {
+			return err
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	case FormatSCXML:
+		return hsm.WriteSCXML(definition, w)
+	}
+	return fmt.Errorf("unknown definition format %q", format)
+}
+
+// FormatOf() returns the definition format by the extension of path.
+func FormatOf(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".scxml", ".xml":
+		return FormatSCXML, nil
+	}
+	return "", fmt.Errorf("unknown definition format of file %q", path)
+}
+
+// ReadFile() reads the definition document at path.
+// The format is determined by the file extension.
+func ReadFile(path string) (*hsm.Definition, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	definition, err := Read(file, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return definition, nil
+}
+
+// LoadJSON() builds a state machine from the JSON definition read from r.
+// The returned state machine is not initialized.
+func LoadJSON(r io.Reader, bindings *hsm.Bindings) (*hsm.StdHSM, error) {
+	definition, err := Read(r, FormatJSON)
+	if err != nil {
+		return nil, err
+	}
+	return hsm.Build(definition, bindings)
+}
+
+// LoadYAML() builds a state machine from the YAML definition read from r.
+// The returned state machine is not initialized.
+func LoadYAML(r io.Reader, bindings *hsm.Bindings) (*hsm.StdHSM, error) {
+	definition, err := Read(r, FormatYAML)
+	if err != nil {
+		return nil, err
+	}
+	return hsm.Build(definition, bindings)
+}
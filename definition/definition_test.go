@@ -0,0 +1,135 @@
+package definition
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAML = `
+name: door
+initial: closed
+states:
+  - id: closed
+    entry: [lightOff]
+    transitions:
+      - {event: open, target: opened, guard: unlocked, actions: [beep]}
+      - {event: knock, actions: [beep]}
+  - id: opened
+    transitions:
+      - {event: close, target: closed}
+`
+
+func newTestBindings(log *[]string) *hsm.Bindings {
+	record := func(name string) hsm.Action {
+		return func(sm hsm.HSM, event hsm.Event) {
+			*log = append(*log, name)
+		}
+	}
+	return hsm.NewBindings().
+		BindAction("lightOff", record("lightOff")).
+		BindAction("beep", record("beep")).
+		BindGuard("unlocked", func(sm hsm.HSM, event hsm.Event) bool {
+			return true
+		})
+}
+
+func TestLoadYAML(t *testing.T) {
+	var log []string
+	sm, err := LoadYAML(strings.NewReader(testYAML), newTestBindings(&log))
+	assert.Nil(t, err)
+	sm.Init()
+	sm.Dispatch(hsm.NewStdEvent(hsm.InternEventType("knock")))
+	assert.Equal(t, "closed", sm.GetState().ID())
+	sm.Dispatch(hsm.NewStdEvent(hsm.InternEventType("open")))
+	assert.Equal(t, "opened", sm.GetState().ID())
+	sm.Dispatch(hsm.NewStdEvent(hsm.InternEventType("close")))
+	assert.Equal(t, "closed", sm.GetState().ID())
+	assert.Equal(t,
+		[]string{"lightOff", "beep", "beep", "lightOff"}, log)
+	// the names of actions and guards must be bound
+	_, err = LoadYAML(strings.NewReader(testYAML), nil)
+	assert.NotNil(t, err)
+}
+
+func TestFormats(t *testing.T) {
+	definition, err := Read(strings.NewReader(testYAML), FormatYAML)
+	assert.Nil(t, err)
+	for _, format := range []string{FormatJSON, FormatYAML, FormatSCXML} {
+		var buf bytes.Buffer
+		assert.Nil(t, Write(definition, &buf, format))
+		again, err := Read(&buf, format)
+		assert.Nil(t, err, format)
+		assert.Equal(t, definition, again, format)
+	}
+	_, err = Read(strings.NewReader(testYAML), "toml")
+	assert.NotNil(t, err)
+}
+
+func TestReadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "door.yml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(testYAML), 0644))
+	definition, err := ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "door", definition.Name)
+
+	path = filepath.Join(dir, "empty.yaml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("states: []\n"), 0644))
+	_, err = ReadFile(path)
+	assert.EqualError(t, err, path+": states: fewer than 1 items")
+
+	_, err = ReadFile(filepath.Join(dir, "door.txt"))
+	assert.NotNil(t, err)
+}
+
+func TestValidation(t *testing.T) {
+	invalid := map[string]string{
+		"unknown field":  "states:\n  - id: a\n    entry_actions: [x]\n",
+		"no state":       "name: empty\n",
+		"duplicate id":   "states:\n  - id: a\n  - id: a\n",
+		"reserved id":    "states:\n  - id: TOP\n",
+		"bad initial":    "states:\n  - id: a\n    initial: b\n",
+		"unknown target": "states:\n  - id: a\n    transitions:\n      - {event: x, target: b}\n",
+		"no event":       "states:\n  - id: a\n    transitions:\n      - {target: a}\n",
+		"reserved event": "states:\n  - id: a\n    transitions:\n      - {event: Exit}\n",
+		"bad history":    "states:\n  - id: a\n    history: later\n",
+	}
+	for name, doc := range invalid {
+		_, err := Read(strings.NewReader(doc), FormatYAML)
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestValidateSchema(t *testing.T) {
+	// the schema is a valid JSON document
+	var document interface{}
+	assert.Nil(t, json.Unmarshal(Schema, &document))
+
+	invalid := map[string]string{
+		`{"states": [{"id": "a", "entry_actions": ["x"]}]}`: `states[0]: unknown property "entry_actions"`,
+		`{"name": "empty"}`:                                                    `document: missing property "states"`,
+		`{"version": -1, "states": [{"id": "a"}]}`:                             `version: less than 0`,
+		`{"version": 1.5, "states": [{"id": "a"}]}`:                            `version: integer expected`,
+		`{"states": [{"id": "TOP"}]}`:                                          `states[0].id: TOP is not allowed`,
+		`{"states": [{"id": ""}]}`:                                             `states[0].id: shorter than 1`,
+		`{"states": [{"id": "a", "final": "yes"}]}`:                            `states[0].final: boolean expected`,
+		`{"states": [{"id": "a", "transitions": [{"target": "a"}]}]}`:          `states[0].transitions[0]: missing property "event"`,
+		`{"states": [{"id": "a", "states": [{"id": "b", "history": "all"}]}]}`: `states[0].states[0].history: all is not one of [shallow deep]`,
+	}
+	for doc, message := range invalid {
+		var document interface{}
+		assert.Nil(t, json.Unmarshal([]byte(doc), &document))
+		assert.EqualError(t, ValidateSchema(document), message, doc)
+	}
+	// the numbers decoded from YAML are checked as well
+	_, err := Read(strings.NewReader(
+		"version: -1\nstates:\n  - id: a\n"), FormatYAML)
+	assert.EqualError(t, err, "version: less than 0")
+}
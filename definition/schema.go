@@ -0,0 +1,187 @@
+package definition
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema is the JSON schema of definition documents, which editors could
+// use for completion and checking as well.
+//
+//go:embed definition.schema.json
+var Schema []byte
+
+// schema is the part of JSON schema draft-07 used by Schema.
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Properties           map[string]*schema `json:"properties"`
+	Items                *schema            `json:"items"`
+	Enum                 []interface{}      `json:"enum"`
+	Not                  *schema            `json:"not"`
+	MinLength            *int               `json:"minLength"`
+	MinItems             *int               `json:"minItems"`
+	Minimum              *float64           `json:"minimum"`
+	Definitions          map[string]*schema `json:"definitions"`
+}
+
+var rootSchema = func() *schema {
+	s := &schema{}
+	if err := json.Unmarshal(Schema, s); err != nil {
+		panic(err)
+	}
+	return s
+}()
+
+// ValidateSchema() checks the document decoded from JSON or YAML
+// against Schema. It returns the first violation found, prefixed by
+// its path like "states[0].transitions[1]".
+func ValidateSchema(document interface{}) error {
+	return rootSchema.validate(rootSchema, normalize(document), "")
+}
+
+// normalize() converts the values decoded from YAML to the ones decoded
+// from JSON: maps with string keys and float64 numbers.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[key] = normalize(elem)
+		}
+		return m
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[fmt.Sprint(key)] = normalize(elem)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, elem := range v {
+			l[i] = normalize(elem)
+		}
+		return l
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	return value
+}
+
+// join() appends the name of property or index to path.
+func join(path string, name interface{}) string {
+	if i, ok := name.(int); ok {
+		return fmt.Sprintf("%s[%d]", path, i)
+	}
+	if path == "" {
+		return name.(string)
+	}
+	return path + "." + name.(string)
+}
+
+func violation(path, format string, v ...interface{}) error {
+	if path == "" {
+		path = "document"
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, v...))
+}
+
+func (self *schema) validate(root *schema, value interface{}, path string) error {
+	if self.Ref != "" {
+		name := strings.TrimPrefix(self.Ref, "#/definitions/")
+		return root.Definitions[name].validate(root, value, path)
+	}
+	if self.Type != "" && !hasType(value, self.Type) {
+		return violation(path, "%s expected", self.Type)
+	}
+	if len(self.Enum) != 0 && !inEnum(value, self.Enum) {
+		return violation(path, "%v is not one of %v", value, self.Enum)
+	}
+	if self.Not != nil && self.Not.validate(root, value, path) == nil {
+		return violation(path, "%v is not allowed", value)
+	}
+	switch v := value.(type) {
+	case string:
+		if self.MinLength != nil && len(v) < *self.MinLength {
+			return violation(path, "shorter than %d", *self.MinLength)
+		}
+	case float64:
+		if self.Minimum != nil && v < *self.Minimum {
+			return violation(path, "less than %v", *self.Minimum)
+		}
+	case []interface{}:
+		if self.MinItems != nil && len(v) < *self.MinItems {
+			return violation(path, "fewer than %d items", *self.MinItems)
+		}
+		if self.Items != nil {
+			for i, elem := range v {
+				if err := self.Items.validate(root, elem, join(path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range self.Required {
+			if _, ok := v[name]; !ok {
+				return violation(path, "missing property %q", name)
+			}
+		}
+		// in order of names for deterministic errors
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := self.Properties[name]
+			if !ok {
+				if self.AdditionalProperties != nil && !*self.AdditionalProperties {
+					return violation(path, "unknown property %q", name)
+				}
+				continue
+			}
+			if err := property.validate(root, v[name], join(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasType(value interface{}, t string) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return t == "object"
+	case []interface{}:
+		return t == "array"
+	case string:
+		return t == "string"
+	case bool:
+		return t == "boolean"
+	case float64:
+		return t == "number" || (t == "integer" && v == math.Trunc(v))
+	case nil:
+		return t == "null"
+	}
+	return false
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(value, e) {
+			return true
+		}
+	}
+	return false
+}
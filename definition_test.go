@@ -0,0 +1,266 @@
+package hsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testJSON = `
+{
+  "name": "door",
+  "initial": "closed",
+  "states": [
+    {
+      "id": "closed",
+      "entry": ["lightOff"],
+      "transitions": [
+        {"event": "open", "target": "opened", "guard": "unlocked", "actions": ["beep"]},
+        {"event": "knock", "actions": ["beep"]}
+      ]
+    },
+    {
+      "id": "opened",
+      "transitions": [
+        {"event": "close", "target": "closed"}
+      ]
+    }
+  ]
+}
+`
+
+func newTestBindings(log *[]string) *Bindings {
+	record := func(name string) Action {
+		return func(sm HSM, event Event) {
+			*log = append(*log, name)
+		}
+	}
+	unlocked := true
+	return NewBindings().
+		BindAction("lightOff", record("lightOff")).
+		BindAction("beep", record("beep")).
+		BindGuard("unlocked", func(sm HSM, event Event) bool {
+			return unlocked
+		})
+}
+
+// readTestDefinition() decodes the JSON definition doc. The documents
+// in JSON and YAML are read by package definition, which imports hsm.
+func readTestDefinition(doc string) (*Definition, error) {
+	definition := &Definition{}
+	decoder := json.NewDecoder(strings.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(definition); err != nil {
+		return nil, err
+	}
+	if err := definition.Validate(nil); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// loadTestDefinition() builds a state machine from the JSON definition doc.
+func loadTestDefinition(doc string, bindings *Bindings) (*StdHSM, error) {
+	definition, err := readTestDefinition(doc)
+	if err != nil {
+		return nil, err
+	}
+	return Build(definition, bindings)
+}
+
+func TestBuildDefinition(t *testing.T) {
+	var log []string
+	sm, err := loadTestDefinition(testJSON, newTestBindings(&log))
+	assert.Nil(t, err)
+	sm.Init()
+	sm.Dispatch(NewStdEvent(InternEventType("knock")))
+	assert.Equal(t, "closed", sm.GetState().ID())
+	sm.Dispatch(NewStdEvent(InternEventType("open")))
+	assert.Equal(t, "opened", sm.GetState().ID())
+	sm.Dispatch(NewStdEvent(InternEventType("close")))
+	assert.Equal(t, "closed", sm.GetState().ID())
+	assert.Equal(t,
+		[]string{"lightOff", "beep", "beep", "lightOff"}, log)
+}
+
+func TestDefinitionSCXML(t *testing.T) {
+	definition, err := readTestDefinition(testJSON)
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSCXML(definition, &buf))
+	again, err := ReadSCXML(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, definition, again)
+}
+
+func TestDefinitionValidation(t *testing.T) {
+	invalid := map[string]string{
+		"no state":       `{"name": "empty"}`,
+		"duplicate id":   `{"states": [{"id": "a"}, {"id": "a"}]}`,
+		"reserved id":    `{"states": [{"id": "TOP"}]}`,
+		"bad initial":    `{"states": [{"id": "a", "initial": "b"}]}`,
+		"unknown target": `{"states": [{"id": "a", "transitions": [{"event": "x", "target": "b"}]}]}`,
+		"no event":       `{"states": [{"id": "a", "transitions": [{"target": "a"}]}]}`,
+		"reserved event": `{"states": [{"id": "a", "transitions": [{"event": "Exit"}]}]}`,
+	}
+	for name, doc := range invalid {
+		_, err := readTestDefinition(doc)
+		assert.NotNil(t, err, name)
+	}
+	// the names of actions and guards must be bound
+	_, err := loadTestDefinition(testJSON, nil)
+	assert.NotNil(t, err)
+}
+
+func TestDefinitionLint(t *testing.T) {
+	definition, err := readTestDefinition(`
+{
+  "states": [
+    {
+      "id": "a",
+      "transitions": [
+        {"event": "x", "target": "b"},
+        {"event": "x", "target": "c"}
+      ]
+    },
+    {
+      "id": "b",
+      "states": [{"id": "b1"}, {"id": "b2"}]
+    },
+    {
+      "id": "c",
+      "final": true,
+      "transitions": [{"event": "y", "target": "a"}]
+    }
+  ]
+}
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`transition #2 of state "a" on "x" is shadowed`,
+		`state "b2" is unreachable`,
+		`final state "c" has transitions`,
+	}, definition.Lint())
+
+	// the history without default resumes the initial child of b
+	definition, err = readTestDefinition(`
+{
+  "states": [
+    {
+      "id": "a",
+      "transitions": [{"event": "x", "target": "h"}]
+    },
+    {
+      "id": "b",
+      "initial": "b2",
+      "states": [
+        {"id": "h", "history": "shallow"},
+        {"id": "b1"},
+        {"id": "b2"}
+      ]
+    }
+  ]
+}
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`state "b1" is unreachable`}, definition.Lint())
+}
+
+// newHistoryDefinition() returns a definition where s1 resumes its child
+// state by shallow history h, or its leaf state by deep history hd.
+func newHistoryDefinition() *Definition {
+	return &Definition{
+		Name: "history",
+		States: []*StateDefinition{
+			{
+				ID: "s1",
+				Transitions: []*TransitionDefinition{
+					{Event: "X", Target: "s2"},
+				},
+				States: []*StateDefinition{
+					{ID: "h", History: HistoryShallow},
+					{ID: "hd", History: HistoryDeep, Initial: "b2"},
+					{
+						ID: "a",
+						Transitions: []*TransitionDefinition{
+							{Event: "N", Target: "b"},
+						},
+					},
+					{
+						ID: "b",
+						States: []*StateDefinition{
+							{
+								ID: "b1",
+								Transitions: []*TransitionDefinition{
+									{Event: "N", Target: "b2"},
+								},
+							},
+							{ID: "b2"},
+						},
+					},
+				},
+			},
+			{
+				ID: "s2",
+				Transitions: []*TransitionDefinition{
+					{Event: "Y", Target: "h"},
+					{Event: "Z", Target: "hd"},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildHistory(t *testing.T) {
+	sm, err := Build(newHistoryDefinition(), nil)
+	assert.Nil(t, err)
+	h := sm.StateTable["h"].(*History)
+	hd := sm.StateTable["hd"].(*History)
+	// the defaults before s1 is ever exited
+	assert.Equal(t, "a", h.Resume())
+	assert.Equal(t, "b2", hd.Resume())
+	sm.Init()
+	assert.Equal(t, "a", sm.State.ID())
+	dispatch := func(name string) string {
+		sm.Dispatch(StdEventOf(InternEventType(name)))
+		return sm.State.ID()
+	}
+	assert.Equal(t, "b1", dispatch("N"))
+	assert.Equal(t, "b2", dispatch("N"))
+	assert.Equal(t, "s2", dispatch("X"))
+	// shallow history resumes b, which is initialized to b1
+	assert.Equal(t, "b1", dispatch("Y"))
+	assert.Equal(t, "b2", dispatch("N"))
+	assert.Equal(t, "s2", dispatch("X"))
+	// deep history resumes b2
+	assert.Equal(t, "b2", dispatch("Z"))
+	assert.Equal(t, "s2", dispatch("X"))
+	// the chains cached are keyed by the states resumed
+	assert.Equal(t, "b1", dispatch("Y"))
+	h.Reset()
+	assert.Equal(t, "s2", dispatch("X"))
+	assert.Equal(t, "b", h.Resume())
+	assert.Equal(t, "b1", hd.Resume())
+
+	// the history could not be flattened or be the initial state
+	_, err = Flatten(newHistoryDefinition(), nil)
+	assert.NotNil(t, err)
+	invalid := []func(d *Definition){
+		func(d *Definition) { d.States[0].Initial = "h" },
+		func(d *Definition) { d.States[0].States[0].History = "bogus" },
+		func(d *Definition) { d.States[0].States[1].Initial = "s2" },
+		func(d *Definition) { d.States[0].States[0].Exit = []string{"x"} },
+		func(d *Definition) {
+			d.States = append(d.States,
+				&StateDefinition{ID: "top", History: HistoryShallow})
+		},
+		func(d *Definition) { d.States[1].States = d.States[0].States[:1] },
+	}
+	for i, change := range invalid {
+		d := newHistoryDefinition()
+		change(d)
+		assert.NotNil(t, d.Validate(nil), "case %d", i)
+	}
+}
@@ -0,0 +1,35 @@
+package hsm
+
+import (
+	"fmt"
+)
+
+// ErrState is implemented by the states whose handlers could fail.
+// HandleErr() is called in place of Handle() when an event is dispatched.
+// The error returned is delivered as an ErrorEvent to the super state,
+// and bubbles up through Super() until some super state handles it,
+// as any other event unhandled.
+type ErrState interface {
+	HandleErr(hsm HSM, event Event) (State, error)
+}
+
+// ErrorEvent delivers the error returned by ErrState to the super states.
+type ErrorEvent struct {
+	// The error returned
+	Err error
+	// The event which failed to be handled
+	Event Event
+	// The state which returned the error
+	StateID string
+}
+
+// Type() is part of interface Event.
+func (*ErrorEvent) Type() EventType {
+	return EventError
+}
+
+// String() describes the error and where it happened.
+func (self *ErrorEvent) String() string {
+	return fmt.Sprintf("error from %s on event %s: %v",
+		self.StateID, EventName(self.Event.Type()), self.Err)
+}
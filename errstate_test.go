@@ -0,0 +1,94 @@
+package hsm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testErrState fails to handle event A, and handles the rest as testState.
+type testErrState struct {
+	*testState
+}
+
+func (self *testErrState) HandleErr(sm HSM, event Event) (State, error) {
+	if event.Type() == testEventA {
+		return nil, errors.New("A failed")
+	}
+	return self.Handle(sm, event), nil
+}
+
+// testCatchState transfers to s2 on errors.
+type testCatchState struct {
+	*testState
+	caught *ErrorEvent
+}
+
+func (self *testCatchState) Handle(sm HSM, event Event) State {
+	if e, ok := event.(*ErrorEvent); ok {
+		self.caught = e
+		sm.QTran("s2")
+		return nil
+	}
+	return self.testState.Handle(sm, event)
+}
+
+// newTestErrHSM() builds the state machine where s11 fails on A, and
+// its super state s1 catches the errors if catch is true.
+func newTestErrHSM(log *[]string, catch bool) (*StdHSM, *testCatchState) {
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	var s1 State
+	var catcher *testCatchState
+	s := &testState{StateHead: NewStateHead(top), id: "s1", init: "s11", log: log}
+	if catch {
+		catcher = &testCatchState{testState: s}
+		s1 = catcher
+	} else {
+		s1 = s
+	}
+	top.AddChild(s1)
+	s11 := &testErrState{&testState{
+		StateHead: NewStateHead(s1), id: "s11", log: log,
+		trans: map[EventType]string{testEventB: "s2"}}}
+	s1.AddChild(s11)
+	newTestState(top, "s2", "", nil, log)
+	return NewStdHSM(HSMTypeStd, top, initial), catcher
+}
+
+func TestErrorEventBubbles(t *testing.T) {
+	var log []string
+	sm, catcher := newTestErrHSM(&log, true)
+	var traced []string
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceHandle {
+			traced = append(traced, record.String())
+		}
+	}))
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s2", sm.GetState().ID())
+	assert.Equal(t, "s11", catcher.caught.StateID)
+	assert.Equal(t, testEventA, catcher.caught.Event.Type())
+	assert.Equal(t, "A failed", catcher.caught.Err.Error())
+	assert.Equal(t, []string{"s1-Handle(Error)"}, traced)
+}
+
+func TestErrorEventUnhandled(t *testing.T) {
+	var log []string
+	sm, _ := newTestErrHSM(&log, false)
+	var warnings []string
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceWarning {
+			warnings = append(warnings, record.Message)
+		}
+	}))
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s11", sm.GetState().ID())
+	assert.Equal(t, []string{
+		"unhandled error from s11 on event A: A failed"}, warnings)
+	// events handled without error work as usual
+	sm.Dispatch(NewStdEvent(testEventB))
+	assert.Equal(t, "s2", sm.GetState().ID())
+}
@@ -1,5 +1,10 @@
 package hsm
 
+import (
+	"fmt"
+	"sync"
+)
+
 type EventType uint32
 
 // The types of predefined events.
@@ -11,6 +16,11 @@ const (
 	EventUser
 )
 
+// EventError is the type of ErrorEvent. It's the last event type rather
+// than one before EventUser, so that the user event types defined
+// from EventUser are kept, and it's never allocated by InternEventType().
+const EventError EventType = ^EventType(0)
+
 // The default events(used in state transfer procedure).
 // They are defined as global const for optimization.
 var StdEvents = map[EventType]*StdEvent{
@@ -39,3 +49,140 @@ func NewStdEvent(eventType EventType) *StdEvent {
 func (stdEvent *StdEvent) Type() EventType {
 	return stdEvent.EventType
 }
+
+// eventRegistry maps event types to their names and vice versa.
+// It's shared by the whole library so that tracers, exporters and
+// error messages print the same name for the same event type.
+type eventRegistry struct {
+	lock   sync.RWMutex
+	names  map[EventType]string
+	values map[string]EventType
+	// the shared events of all the types registered, see StdEventOf()
+	events map[EventType]*StdEvent
+	// the next type to allocate in InternEventType()
+	next EventType
+}
+
+// EventInterned is the first event type allocated by InternEventType().
+// It leaves the lower types for events defined in Go codes.
+const EventInterned EventType = 1 << 31
+
+var registry = &eventRegistry{
+	names:  make(map[EventType]string),
+	values: make(map[string]EventType),
+	events: make(map[EventType]*StdEvent),
+	next:   EventInterned,
+}
+
+func init() {
+	RegisterEventType(EventEmpty, "Empty")
+	RegisterEventType(EventInit, "Init")
+	RegisterEventType(EventEntry, "Entry")
+	RegisterEventType(EventExit, "Exit")
+	RegisterEventType(EventError, "Error")
+}
+
+// RegisterEventType() associates name with event type t in the library wide
+// registry. It returns an error if t or name is already registered.
+func RegisterEventType(t EventType, name string) error {
+	if name == "" {
+		return fmt.Errorf("empty name for event type %d", uint32(t))
+	}
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if old, ok := registry.names[t]; ok {
+		return fmt.Errorf(
+			"event type %d already registered as %q", uint32(t), old)
+	}
+	if old, ok := registry.values[name]; ok {
+		return fmt.Errorf(
+			"event name %q already registered for type %d", name, uint32(old))
+	}
+	registry.names[t] = name
+	registry.values[name] = t
+	registry.events[t] = NewStdEvent(t)
+	return nil
+}
+
+// IsReservedEventType() tests whether t is the type of a built-in event,
+// which is dispatched by the library itself rather than by users.
+func IsReservedEventType(t EventType) bool {
+	return t < EventUser || t == EventError
+}
+
+// IsReservedEventName() tests whether name is registered for the type
+// of a built-in event, see IsReservedEventType().
+func IsReservedEventName(name string) bool {
+	t, ok := LookupEventType(name)
+	return ok && IsReservedEventType(t)
+}
+
+// InternEventType() returns the event type registered with name.
+// If there is none, a new type is allocated for name and registered.
+// It's used for state machines loaded from definitions, which refer events
+// by name rather than by type. The names of built-in events are refused,
+// see IsReservedEventName().
+func InternEventType(name string) EventType {
+	AssertNotEqual("", name)
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	if t, ok := registry.values[name]; ok {
+		// the built-in events must not be dispatched by name
+		AssertFalse(IsReservedEventType(t))
+		return t
+	}
+	for {
+		t := registry.next
+		registry.next++
+		if _, ok := registry.names[t]; !ok {
+			registry.names[t] = name
+			registry.values[name] = t
+			registry.events[t] = NewStdEvent(t)
+			return t
+		}
+	}
+}
+
+// StdEventOf() returns the StdEvent of the registered type t, which is
+// shared by the whole library so that dispatching it allocates nothing.
+// The event returned must not be changed.
+func StdEventOf(t EventType) *StdEvent {
+	registry.lock.RLock()
+	event, ok := registry.events[t]
+	registry.lock.RUnlock()
+	AssertTrue(ok)
+	return event
+}
+
+// MustRegisterEventType() is like RegisterEventType() but panics on error.
+// It simplifies registering event types in package level init().
+func MustRegisterEventType(t EventType, name string) {
+	if err := RegisterEventType(t, name); err != nil {
+		panic(err)
+	}
+}
+
+// EventName() returns the registered name of event type t.
+// For unregistered types, a name like "EventType(42)" is returned.
+func EventName(t EventType) string {
+	registry.lock.RLock()
+	name, ok := registry.names[t]
+	registry.lock.RUnlock()
+	if !ok {
+		return fmt.Sprintf("EventType(%d)", uint32(t))
+	}
+	return name
+}
+
+// LookupEventType() returns the event type registered with name.
+func LookupEventType(name string) (EventType, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	t, ok := registry.values[name]
+	return t, ok
+}
+
+// String() makes EventType printable by its registered name.
+func (t EventType) String() string {
+	return EventName(t)
+}
@@ -0,0 +1,58 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// unregisterEventType() removes event type t from the registry, so that
+// the tests registering it could run again.
+func unregisterEventType(t EventType) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	delete(registry.values, registry.names[t])
+	delete(registry.names, t)
+	delete(registry.events, t)
+}
+
+func TestEventRegistry(t *testing.T) {
+	assert.Equal(t, "Init", EventName(EventInit))
+	assert.Equal(t, "Exit", EventExit.String())
+	assert.Equal(t, "Error", EventError.String())
+	const eventFoo = EventUser + 1000
+	assert.Equal(t, "EventType(1004)", EventName(eventFoo))
+	assert.Nil(t, RegisterEventType(eventFoo, "Foo"))
+	defer unregisterEventType(eventFoo)
+	assert.Equal(t, "Foo", eventFoo.String())
+	value, ok := LookupEventType("Foo")
+	assert.True(t, ok)
+	assert.Equal(t, eventFoo, value)
+	// duplicate number and duplicate name are both rejected
+	assert.NotNil(t, RegisterEventType(eventFoo, "Bar"))
+	assert.NotNil(t, RegisterEventType(eventFoo+1, "Foo"))
+	_, ok = LookupEventType("Bar")
+	assert.False(t, ok)
+}
+
+func TestReservedEvents(t *testing.T) {
+	for _, name := range []string{"Empty", "Init", "Entry", "Exit", "Error"} {
+		assert.True(t, IsReservedEventName(name), name)
+		assert.Panics(t, func() { InternEventType(name) }, name)
+	}
+	assert.False(t, IsReservedEventName("A"))
+	assert.False(t, IsReservedEventName("no such event"))
+	assert.False(t, IsReservedEventType(EventUser))
+	assert.True(t, IsReservedEventType(EventError))
+	// the user event types are not shifted by EventError
+	assert.Equal(t, EventType(4), EventUser)
+}
+
+func TestStdEventOf(t *testing.T) {
+	event := StdEventOf(testEventA)
+	assert.Equal(t, testEventA, event.Type())
+	assert.Same(t, event, StdEventOf(testEventA))
+	allocs := testing.AllocsPerRun(100, func() {
+		StdEventOf(testEventA)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
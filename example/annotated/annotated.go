@@ -2,7 +2,16 @@ package annotated
 
 import hsm "github.com/hhkbp2/go-hsm"
 
+// NewWorld() creates the annotated state machine and initializes it.
 func NewWorld() *AnnotatedHSM {
+	sm := NewUninitializedWorld()
+	sm.Init()
+	return sm
+}
+
+// NewUninitializedWorld() creates the annotated state machine, which is
+// not initialized, e.g. for the factory of package repl.
+func NewUninitializedWorld() *AnnotatedHSM {
 	top := hsm.NewTop()
 	initial := hsm.NewInitial(top, StateS0ID)
 	s0 := NewS0State(top)
@@ -12,6 +21,24 @@ func NewWorld() *AnnotatedHSM {
 	s21 := NewS21State(s2)
 	NewS211State(s21)
 	sm := NewAnnotatedHSM(top, initial)
-	sm.Init()
+	// declare the transitions for the tools which render state chart
+	sm.DeclareTransition(StateS0ID, hsm.EventInit, StateS1ID)
+	sm.DeclareTransition(StateS1ID, hsm.EventInit, StateS11ID)
+	sm.DeclareTransition(StateS2ID, hsm.EventInit, StateS21ID)
+	sm.DeclareTransition(StateS21ID, hsm.EventInit, StateS211ID)
+	sm.DeclareTransition(StateS0ID, EventE, StateS211ID)
+	sm.DeclareTransition(StateS1ID, EventA, StateS1ID)
+	sm.DeclareTransition(StateS1ID, EventB, StateS11ID)
+	sm.DeclareTransition(StateS1ID, EventC, StateS2ID)
+	sm.DeclareTransition(StateS1ID, EventD, StateS0ID)
+	sm.DeclareTransition(StateS1ID, EventF, StateS211ID)
+	sm.DeclareTransition(StateS11ID, EventG, StateS211ID)
+	sm.DeclareTransition(StateS11ID, EventH, "")
+	sm.DeclareTransition(StateS2ID, EventC, StateS1ID)
+	sm.DeclareTransition(StateS2ID, EventF, StateS11ID)
+	sm.DeclareTransition(StateS21ID, EventB, StateS211ID)
+	sm.DeclareTransition(StateS21ID, EventH, StateS21ID)
+	sm.DeclareTransition(StateS211ID, EventD, StateS21ID)
+	sm.DeclareTransition(StateS211ID, EventG, StateS0ID)
 	return sm
 }
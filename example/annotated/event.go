@@ -13,6 +13,10 @@ const (
 	EventH
 )
 
+// EventsToStr maps the event types of this example to their names.
+//
+// Deprecated: use hsm.EventName(), which knows the names of all the
+// registered event types.
 var EventsToStr = map[hsm.EventType]string{
 	EventA: "A",
 	EventB: "B",
@@ -24,6 +28,15 @@ var EventsToStr = map[hsm.EventType]string{
 	EventH: "H",
 }
 
+// The event types are registered for their names only. They overlap with
+// the event types of the other examples, so if imported together, a type
+// registered by another example first keeps the name given there.
+func init() {
+	for t := EventA; t <= EventH; t++ {
+		hsm.RegisterEventType(t, EventsToStr[t])
+	}
+}
+
 func PrintEvent(eventType hsm.EventType) string {
 	return EventsToStr[eventType]
 }
@@ -1,10 +1,24 @@
 package c_comment
 
 import (
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/example/annotated"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
 
+// TestEventTypes() checks the overlapping event types of the examples
+// could be registered in the same binary, where annotated is initialized
+// first as a dependency.
+func TestEventTypes(t *testing.T) {
+	assert.Equal(t, EventStar, annotated.EventA)
+	assert.Equal(t, "Slash", hsm.EventName(EventSlash))
+	assert.Equal(t, "A", hsm.EventName(EventStar))
+	assert.Equal(t, "B", hsm.EventName(EventChar))
+	assert.Equal(t, "H", hsm.EventName(annotated.EventH))
+	assert.Equal(t, "H", annotated.PrintEvent(annotated.EventH))
+}
+
 // TestWorld() is a use case of this example state machine.
 func TestWorld(t *testing.T) {
 	sm := NewWorld()
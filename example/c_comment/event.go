@@ -13,6 +13,15 @@ const (
 	EventChar
 )
 
+// The event types are registered for their names only. They overlap with
+// the event types of the other examples, so if imported together, a type
+// registered by another example first keeps the name given there.
+func init() {
+	hsm.RegisterEventType(EventSlash, "Slash")
+	hsm.RegisterEventType(EventStar, "Star")
+	hsm.RegisterEventType(EventChar, "Char")
+}
+
 // CCommentEvent is the general event we use in this example to drive
 // out state machine.
 type CCommentEvent interface {
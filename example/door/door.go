@@ -0,0 +1,6 @@
+// Package door demonstrates the state machine generated by hsmgen from
+// the definition in door.yaml. The generated codes are in door_hsm.go,
+// and the actions and guards written by hand are in door_handlers.go.
+package door
+
+//go:generate hsmgen -package door -mode switch door.yaml
@@ -0,0 +1,44 @@
+// This file is written by hand. hsmgen creates it with stubs of
+// all the actions and guards, and appends stubs for the new ones
+// on regeneration, but never changes the existing codes.
+
+package door
+
+import hsm "github.com/hhkbp2/go-hsm"
+
+// DoorData is the extended state data of DoorHSM.
+type DoorData struct {
+	Light  bool
+	Bolted bool
+	Beeps  int
+}
+
+// LightOff() is the action "lightOff".
+func (self *DoorHSM) LightOff(event hsm.Event) {
+	self.Light = false
+}
+
+// Beep() is the action "beep".
+func (self *DoorHSM) Beep(event hsm.Event) {
+	self.Beeps++
+}
+
+// EngageBolt() is the action "engageBolt".
+func (self *DoorHSM) EngageBolt(event hsm.Event) {
+	self.Bolted = true
+}
+
+// ReleaseBolt() is the action "releaseBolt".
+func (self *DoorHSM) ReleaseBolt(event hsm.Event) {
+	self.Bolted = false
+}
+
+// LightOn() is the action "lightOn".
+func (self *DoorHSM) LightOn(event hsm.Event) {
+	self.Light = true
+}
+
+// NotLocked() is the guard "notLocked".
+func (self *DoorHSM) NotLocked(event hsm.Event) bool {
+	return !self.Bolted
+}
@@ -0,0 +1,251 @@
+// Code generated by hsmgen from door.yaml. DO NOT EDIT.
+
+package door
+
+import (
+	"context"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// The IDs of all states.
+const (
+	StateClosedID   = "closed"
+	StateUnlockedID = "unlocked"
+	StateLockedID   = "locked"
+	StateOpenedID   = "opened"
+)
+
+// The event types, registered by their names.
+var (
+	EventOpen   = hsm.InternEventType("open")
+	EventKnock  = hsm.InternEventType("knock")
+	EventLock   = hsm.InternEventType("lock")
+	EventUnlock = hsm.InternEventType("unlock")
+	EventClose  = hsm.InternEventType("close")
+)
+
+// DoorHSM is the state machine "door".
+type DoorHSM struct {
+	*hsm.StdHSM
+	DoorData
+}
+
+// NewDoorHSM() creates all the states and the state machine.
+// The returned state machine is not initialized.
+func NewDoorHSM() *DoorHSM {
+	top := hsm.NewTop()
+	initial := hsm.NewInitial(top, StateClosedID)
+	closedState := NewClosedState(top)
+	NewUnlockedState(closedState)
+	NewLockedState(closedState)
+	NewOpenedState(top)
+	sm := &DoorHSM{
+		StdHSM: hsm.NewStdHSM(hsm.HSMTypeStd, top, initial),
+	}
+	sm.DeclareTransition(StateClosedID, hsm.EventInit, StateUnlockedID)
+	sm.DeclareTransition(StateClosedID, EventOpen, StateOpenedID)
+	sm.DeclareTransition(StateClosedID, EventKnock, "")
+	sm.DeclareTransition(StateUnlockedID, EventLock, StateLockedID)
+	sm.DeclareTransition(StateLockedID, EventUnlock, StateUnlockedID)
+	sm.DeclareTransition(StateOpenedID, EventClose, StateClosedID)
+	return sm
+}
+
+// Init() is part of interface HSM.
+func (self *DoorHSM) Init() {
+	self.StdHSM.Init2(self, hsm.StdEvents[hsm.EventInit])
+}
+
+// Dispatch() is part of interface HSM.
+func (self *DoorHSM) Dispatch(event hsm.Event) {
+	self.StdHSM.Dispatch2(self, event)
+}
+
+// DispatchContext() dispatches event with ctx, see hsm.ContextOf().
+func (self *DoorHSM) DispatchContext(ctx context.Context, event hsm.Event) error {
+	return self.StdHSM.DispatchContext2(self, ctx, event)
+}
+
+// QTran() is part of interface HSM.
+func (self *DoorHSM) QTran(targetStateID string) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranHSM(self, target)
+}
+
+// QTranOnEvent() is part of interface HSM.
+func (self *DoorHSM) QTranOnEvent(targetStateID string, event hsm.Event) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranHSMOnEvent(self, target, event)
+}
+
+// QTranDyn() is part of interface HSM.
+func (self *DoorHSM) QTranDyn(targetStateID string) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranDynHSM(self, target)
+}
+
+// QTranDynOnEvent() is part of interface HSM.
+func (self *DoorHSM) QTranDynOnEvent(targetStateID string, event hsm.Event) {
+	target := self.StdHSM.LookupState(targetStateID)
+	self.StdHSM.QTranDynHSMOnEvent(self, target, event)
+}
+
+// CurrentStateID() returns the ID of current state.
+func (self *DoorHSM) CurrentStateID() string {
+	return self.StdHSM.State.ID()
+}
+
+// ExtendedState() is part of interface ExtendedState.
+func (self *DoorHSM) ExtendedState() interface{} {
+	return &self.DoorData
+}
+
+// Snapshot() takes the snapshot of the current state and DoorData.
+func (self *DoorHSM) Snapshot(codec hsm.Codec) (*hsm.Snapshot, error) {
+	return self.StdHSM.Snapshot2(self, codec)
+}
+
+// Restore() resumes the state machine from snapshot in place of Init().
+func (self *DoorHSM) Restore(snapshot *hsm.Snapshot, codec hsm.Codec) error {
+	return self.StdHSM.Restore2(self, snapshot, codec)
+}
+
+// ClosedState is the state "closed".
+type ClosedState struct {
+	*hsm.StateHead
+}
+
+func NewClosedState(super hsm.State) *ClosedState {
+	object := &ClosedState{
+		hsm.NewStateHead(super),
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (*ClosedState) ID() string {
+	return StateClosedID
+}
+
+func (self *ClosedState) Init(sm hsm.HSM, event hsm.Event) hsm.State {
+	sm.QInit(StateUnlockedID)
+	return nil
+}
+
+func (self *ClosedState) Entry(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*DoorHSM)
+	m.LightOff(event)
+	return nil
+}
+
+func (self *ClosedState) Handle(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*DoorHSM)
+	switch event.Type() {
+	case EventOpen:
+		if m.NotLocked(event) {
+			sm.QTran(StateOpenedID)
+			return nil
+		}
+	case EventKnock:
+		m.Beep(event)
+		return nil
+	}
+	return self.Super()
+}
+
+// UnlockedState is the state "unlocked".
+type UnlockedState struct {
+	*hsm.StateHead
+}
+
+func NewUnlockedState(super hsm.State) *UnlockedState {
+	object := &UnlockedState{
+		hsm.NewStateHead(super),
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (*UnlockedState) ID() string {
+	return StateUnlockedID
+}
+
+func (self *UnlockedState) Handle(sm hsm.HSM, event hsm.Event) hsm.State {
+	switch event.Type() {
+	case EventLock:
+		sm.QTran(StateLockedID)
+		return nil
+	}
+	return self.Super()
+}
+
+// LockedState is the state "locked".
+type LockedState struct {
+	*hsm.StateHead
+}
+
+func NewLockedState(super hsm.State) *LockedState {
+	object := &LockedState{
+		hsm.NewStateHead(super),
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (*LockedState) ID() string {
+	return StateLockedID
+}
+
+func (self *LockedState) Entry(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*DoorHSM)
+	m.EngageBolt(event)
+	return nil
+}
+
+func (self *LockedState) Exit(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*DoorHSM)
+	m.ReleaseBolt(event)
+	return nil
+}
+
+func (self *LockedState) Handle(sm hsm.HSM, event hsm.Event) hsm.State {
+	switch event.Type() {
+	case EventUnlock:
+		sm.QTran(StateUnlockedID)
+		return nil
+	}
+	return self.Super()
+}
+
+// OpenedState is the state "opened".
+type OpenedState struct {
+	*hsm.StateHead
+}
+
+func NewOpenedState(super hsm.State) *OpenedState {
+	object := &OpenedState{
+		hsm.NewStateHead(super),
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (*OpenedState) ID() string {
+	return StateOpenedID
+}
+
+func (self *OpenedState) Entry(sm hsm.HSM, event hsm.Event) hsm.State {
+	m := sm.(*DoorHSM)
+	m.LightOn(event)
+	return nil
+}
+
+func (self *OpenedState) Handle(sm hsm.HSM, event hsm.Event) hsm.State {
+	switch event.Type() {
+	case EventClose:
+		sm.QTran(StateClosedID)
+		return nil
+	}
+	return self.Super()
+}
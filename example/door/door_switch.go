@@ -0,0 +1,126 @@
+// Code generated by hsmgen from door.yaml. DO NOT EDIT.
+
+package door
+
+import (
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// The indexes of all states in DoorSwitch.
+const (
+	DoorSwitchClosed = iota
+	DoorSwitchUnlocked
+	DoorSwitchLocked
+	DoorSwitchOpened
+)
+
+// The IDs and the indexes of super states of all states, by their indexes.
+var (
+	DoorSwitchIDs = [...]string{
+		StateClosedID,
+		StateUnlockedID,
+		StateLockedID,
+		StateOpenedID,
+	}
+	DoorSwitchSupers = [...]int{
+		-1,
+		0,
+		0,
+		-1,
+	}
+	// the events passed to entry and exit actions like hsm.StdHSM
+	doorSwitchEntry hsm.Event = hsm.StdEvents[hsm.EventEntry]
+	doorSwitchExit  hsm.Event = hsm.StdEvents[hsm.EventExit]
+)
+
+// DoorSwitch is the state machine "door" which dispatches
+// events by switch statements, with the transitions resolved at generation.
+// The actions and guards are called on a DoorHSM, which holds
+// the extended state but is never initialized itself.
+type DoorSwitch struct {
+	// The index of current state, which is always a leaf, -1 before Init()
+	State int
+	// the receiver of the actions and guards
+	actions *DoorHSM
+}
+
+// NewDoorSwitch() creates the state machine, which is not initialized.
+func NewDoorSwitch() *DoorSwitch {
+	return &DoorSwitch{State: -1, actions: NewDoorHSM()}
+}
+
+// Data() returns the extended state of the actions and guards.
+func (self *DoorSwitch) Data() *DoorData {
+	return &self.actions.DoorData
+}
+
+// Init() enters the initial states.
+func (self *DoorSwitch) Init() {
+	self.actions.LightOff(doorSwitchEntry)
+	self.State = DoorSwitchUnlocked
+}
+
+// Dispatch() takes the first transition of event from current state whose
+// guard holds, and ignores the event if there is none.
+func (self *DoorSwitch) Dispatch(event hsm.Event) {
+	switch self.State {
+	case DoorSwitchUnlocked:
+		switch event.Type() {
+		case EventOpen:
+			if self.actions.NotLocked(event) {
+				// closed -> opened
+				self.actions.LightOn(doorSwitchEntry)
+				self.State = DoorSwitchOpened
+				return
+			}
+		case EventKnock:
+			// closed: internal transition
+			self.actions.Beep(event)
+		case EventLock:
+			// unlocked -> locked
+			self.actions.EngageBolt(doorSwitchEntry)
+			self.State = DoorSwitchLocked
+		}
+	case DoorSwitchLocked:
+		switch event.Type() {
+		case EventOpen:
+			if self.actions.NotLocked(event) {
+				// closed -> opened
+				self.actions.ReleaseBolt(doorSwitchExit)
+				self.actions.LightOn(doorSwitchEntry)
+				self.State = DoorSwitchOpened
+				return
+			}
+		case EventKnock:
+			// closed: internal transition
+			self.actions.Beep(event)
+		case EventUnlock:
+			// locked -> unlocked
+			self.actions.ReleaseBolt(doorSwitchExit)
+			self.State = DoorSwitchUnlocked
+		}
+	case DoorSwitchOpened:
+		switch event.Type() {
+		case EventClose:
+			// opened -> closed
+			self.actions.LightOff(doorSwitchEntry)
+			self.State = DoorSwitchUnlocked
+		}
+	}
+}
+
+// CurrentStateID() returns the ID of current state.
+func (self *DoorSwitch) CurrentStateID() string {
+	return DoorSwitchIDs[self.State]
+}
+
+// IsIn() tests whether the state stateID is current state or any of
+// its super states.
+func (self *DoorSwitch) IsIn(stateID string) bool {
+	for s := self.State; s >= 0; s = DoorSwitchSupers[s] {
+		if DoorSwitchIDs[s] == stateID {
+			return true
+		}
+	}
+	return false
+}
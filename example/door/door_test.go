@@ -0,0 +1,45 @@
+package door
+
+import (
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDoor(t *testing.T) {
+	sm := NewDoorHSM()
+	sm.Init()
+	assert.Equal(t, StateUnlockedID, sm.CurrentStateID())
+	sm.Dispatch(hsm.NewStdEvent(EventLock))
+	assert.Equal(t, StateLockedID, sm.CurrentStateID())
+	assert.True(t, sm.Bolted)
+	// the door could not be opened when locked
+	sm.Dispatch(hsm.NewStdEvent(EventOpen))
+	assert.Equal(t, StateLockedID, sm.CurrentStateID())
+	sm.Dispatch(hsm.NewStdEvent(EventKnock))
+	assert.Equal(t, 1, sm.Beeps)
+	sm.Dispatch(hsm.NewStdEvent(EventUnlock))
+	assert.False(t, sm.Bolted)
+	sm.Dispatch(hsm.NewStdEvent(EventOpen))
+	assert.Equal(t, StateOpenedID, sm.CurrentStateID())
+	assert.True(t, sm.Light)
+	sm.Dispatch(hsm.NewStdEvent(EventClose))
+	assert.Equal(t, StateUnlockedID, sm.CurrentStateID())
+	assert.False(t, sm.Light)
+}
+
+func TestDoorSnapshot(t *testing.T) {
+	sm := NewDoorHSM()
+	sm.Init()
+	sm.Dispatch(hsm.NewStdEvent(EventLock))
+	sm.Dispatch(hsm.NewStdEvent(EventKnock))
+	snapshot, err := sm.Snapshot(hsm.JSONCodec)
+	assert.Nil(t, err)
+	restored := NewDoorHSM()
+	assert.Nil(t, restored.Restore(snapshot, hsm.JSONCodec))
+	assert.Equal(t, StateLockedID, restored.CurrentStateID())
+	assert.Equal(t, sm.DoorData, restored.DoorData)
+	// exit action of the restored state works as usual
+	restored.Dispatch(hsm.NewStdEvent(EventUnlock))
+	assert.False(t, restored.Bolted)
+}
@@ -0,0 +1,20 @@
+// repl drives the example state machines by hand, e.g.
+//
+//	go run ./example/repl annotated
+package main
+
+import (
+	"github.com/hhkbp2/go-hsm/example/annotated"
+	"github.com/hhkbp2/go-hsm/example/door"
+	"github.com/hhkbp2/go-hsm/repl"
+)
+
+func main() {
+	repl.Register("annotated", func() repl.Machine {
+		return annotated.NewUninitializedWorld()
+	})
+	repl.Register("door", func() repl.Machine {
+		return door.NewDoorHSM()
+	})
+	repl.Main()
+}
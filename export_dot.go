@@ -0,0 +1,186 @@
+package hsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOTOptions controls the output of ExportDOT().
+type DOTOptions struct {
+	// The name of the generated digraph, "hsm" is used if empty
+	Name string
+	// Whether to highlight the current active state and its super states
+	HighlightActive bool
+}
+
+// ExportDOT() writes the state hierarchy and declared transitions of
+// state machine sm to w in Graphviz DOT format. States with children are
+// rendered as nested clusters, and history pseudo-states as circles
+// labeled "H" or "H*" with dashed edges to their default states.
+// A nil opts is the same as a zero DOTOptions.
+func ExportDOT(sm *StdHSM, w io.Writer, opts *DOTOptions) error {
+	if opts == nil {
+		opts = &DOTOptions{}
+	}
+	name := opts.Name
+	if name == "" {
+		name = "hsm"
+	}
+	e := &dotExporter{
+		sm:     sm,
+		opts:   opts,
+		active: make(map[State]bool),
+	}
+	if opts.HighlightActive {
+		for s := sm.State; s != nil; s = s.Super() {
+			e.active[s] = true
+		}
+	}
+	fmt.Fprintf(&e.buf, "digraph %s {\n", dotQuote(name))
+	e.buf.WriteString("\tcompound=true;\n")
+	e.buf.WriteString("\tnode [shape=box, style=rounded];\n")
+	top := sm.StateTable[TopStateID]
+	for _, child := range top.Children() {
+		e.writeState(child, 1)
+	}
+	if initial, ok := sm.StateTable[InitialStateID].(*Initial); ok {
+		e.writeEdge(initial.ID(), initial.InitStateID, nil)
+	}
+	for _, tran := range sm.Transitions {
+		if tran.Event != EventInit {
+			e.writeTransition(tran)
+		}
+	}
+	// the default transitions of history pseudo-states
+	for _, state := range sm.States {
+		if h, ok := state.(*History); ok && h.DefaultStateID != "" {
+			e.writeEdge(h.ID(), h.DefaultStateID, []string{"style=dashed"})
+		}
+	}
+	e.buf.WriteString("}\n")
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// dotExporter holds the intermediate data of ExportDOT().
+type dotExporter struct {
+	sm     *StdHSM
+	opts   *DOTOptions
+	active map[State]bool
+	buf    bytes.Buffer
+}
+
+// isComposite() tests whether state has any child.
+func isComposite(state State) bool {
+	return len(state.Children()) != 0
+}
+
+// isAncestor() tests whether state is ancestor of, or the same as, other.
+func isAncestor(state, other State) bool {
+	for s := other; s != nil; s = s.Super() {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// dotCluster() returns the cluster name for composite state id.
+func dotCluster(id string) string {
+	return dotQuote("cluster_" + id)
+}
+
+func (self *dotExporter) writeState(state State, depth int) {
+	indent := strings.Repeat("\t", depth)
+	id := state.ID()
+	if !isComposite(state) {
+		var attrs []string
+		switch s := state.(type) {
+		case *Initial:
+			attrs = append(attrs,
+				"shape=point", "width=0.15", "label=\"\"")
+		case *Terminal:
+			attrs = append(attrs,
+				"shape=doublecircle", "width=0.2", "label=\"\"")
+		case *History:
+			label := "H"
+			if s.Deep {
+				label = "H*"
+			}
+			attrs = append(attrs, "shape=circle", "width=0.3",
+				"label="+dotQuote(label))
+		default:
+			attrs = append(attrs, "label="+dotQuote(id))
+		}
+		if self.active[state] {
+			attrs = append(attrs, "style=\"rounded,filled\"",
+				"fillcolor=lightblue")
+		}
+		fmt.Fprintf(&self.buf, "%s%s [%s];\n",
+			indent, dotQuote(id), strings.Join(attrs, ", "))
+		return
+	}
+	fmt.Fprintf(&self.buf, "%ssubgraph %s {\n", indent, dotCluster(id))
+	fmt.Fprintf(&self.buf, "%s\tlabel=%s;\n", indent, dotQuote(id))
+	fmt.Fprintf(&self.buf, "%s\tstyle=rounded;\n", indent)
+	if self.active[state] {
+		fmt.Fprintf(&self.buf, "%s\tpenwidth=2;\n", indent)
+		fmt.Fprintf(&self.buf, "%s\tcolor=blue;\n", indent)
+	}
+	// an invisible anchor node for the edges of this composite state
+	fmt.Fprintf(&self.buf,
+		"%s\t%s [shape=point, style=invis, width=0, label=\"\"];\n",
+		indent, dotQuote(id))
+	if init := self.sm.InitialOf(id); init != "" {
+		initial := id + "/" + InitialStateID
+		fmt.Fprintf(&self.buf,
+			"%s\t%s [shape=point, width=0.1, label=\"\"];\n",
+			indent, dotQuote(initial))
+		fmt.Fprintf(&self.buf, "%s\t%s -> %s", indent, dotQuote(initial), dotQuote(init))
+		if isComposite(self.sm.StateTable[init]) {
+			fmt.Fprintf(&self.buf, " [lhead=%s]", dotCluster(init))
+		}
+		self.buf.WriteString(";\n")
+	}
+	for _, child := range state.Children() {
+		self.writeState(child, depth+1)
+	}
+	fmt.Fprintf(&self.buf, "%s}\n", indent)
+}
+
+func (self *dotExporter) writeTransition(tran Transition) {
+	attrs := []string{"label=" + dotQuote(EventName(tran.Event))}
+	target := tran.Target
+	if target == "" {
+		// internal transition
+		target = tran.Source
+		attrs = append(attrs, "style=dashed")
+	}
+	self.writeEdge(tran.Source, target, attrs)
+}
+
+func (self *dotExporter) writeEdge(source, target string, attrs []string) {
+	// clip the edge at cluster borders, unless one end lies inside
+	// the cluster of the other end
+	s, t := self.sm.StateTable[source], self.sm.StateTable[target]
+	if isComposite(s) && !isAncestor(s, t) {
+		attrs = append(attrs, "ltail="+dotCluster(source))
+	}
+	if isComposite(t) && !isAncestor(t, s) {
+		attrs = append(attrs, "lhead="+dotCluster(target))
+	}
+	fmt.Fprintf(&self.buf, "\t%s -> %s", dotQuote(source), dotQuote(target))
+	if len(attrs) != 0 {
+		fmt.Fprintf(&self.buf, " [%s]", strings.Join(attrs, ", "))
+	}
+	self.buf.WriteString(";\n")
+}
+
+// dotQuote() returns s as a double quoted DOT ID.
+func dotQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
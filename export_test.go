@@ -0,0 +1,142 @@
+package hsm
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestExportDOT(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.Init()
+	var buf bytes.Buffer
+	err := ExportDOT(sm, &buf, &DOTOptions{HighlightActive: true})
+	assert.Nil(t, err)
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "digraph \"hsm\" {\n"))
+	assert.Contains(t, out, "subgraph \"cluster_s0\" {")
+	assert.Contains(t, out, "subgraph \"cluster_s21\" {")
+	assert.Contains(t, out, "\"Initial\" [shape=point")
+	assert.Contains(t, out, "\"Terminal\" [shape=doublecircle")
+	assert.Contains(t, out, "\"Initial\" -> \"s0\" [lhead=\"cluster_s0\"];")
+	assert.Contains(t, out,
+		"\"s11\" -> \"s211\" [label=\"G\"];")
+	assert.Contains(t, out,
+		"\"s11\" -> \"s11\" [label=\"H\", style=dashed];")
+	// the active leaf state s11 is filled
+	assert.Contains(t, out,
+		"\"s11\" [label=\"s11\", style=\"rounded,filled\", fillcolor=lightblue];")
+}
+
+func TestExportMermaid(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.DeclareTransition("s0", testEventH, TerminalStateID)
+	sm.Init()
+	var buf bytes.Buffer
+	err := ExportMermaid(sm, &buf, &UMLOptions{HighlightActive: true})
+	assert.Nil(t, err)
+	expected := `stateDiagram-v2
+    [*] --> s0
+    state s0 {
+        [*] --> s1
+        state s1 {
+            [*] --> s11
+            s11
+        }
+        state s2 {
+            [*] --> s21
+            state s21 {
+                [*] --> s211
+                s211
+            }
+        }
+    }
+    s0 --> [*] : H
+    s0 --> s211 : E
+    s1 --> s1 : A
+    s1 --> s11 : B
+    s1 --> s2 : C
+    s1 --> s0 : D
+    s1 --> s211 : F
+    s11 --> s211 : G
+    s11 : H / internal
+    s2 --> s1 : C
+    s2 --> s11 : F
+    s21 --> s211 : B
+    s21 --> s21 : H
+    s211 --> s21 : D
+    s211 --> s0 : G
+    classDef active fill:lightblue
+    class s11 active
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestExportPlantUML(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.Init()
+	var buf bytes.Buffer
+	err := ExportPlantUML(sm, &buf, &UMLOptions{
+		Title:           "annotated",
+		HighlightActive: true,
+	})
+	assert.Nil(t, err)
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "@startuml\ntitle annotated\n"))
+	assert.True(t, strings.HasSuffix(out, "@enduml\n"))
+	assert.Contains(t, out, "  state s0 {\n    [*] --> s1\n")
+	assert.Contains(t, out, "      state s11 #lightblue\n")
+	assert.Contains(t, out, "  s21 --> s211 : B\n")
+}
+
+func TestExportHistory(t *testing.T) {
+	sm, err := Build(newHistoryDefinition(), nil)
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, ExportMermaid(sm, &buf, nil))
+	expected := `stateDiagram-v2
+    [*] --> s1
+    state s1 {
+        [*] --> a
+        state "[H]" as h
+        h --> a
+        state "[H*]" as hd
+        hd --> b2
+        a
+        state b {
+            [*] --> b1
+            b1
+            b2
+        }
+    }
+    s2
+    s1 --> s2 : X
+    a --> b : N
+    b1 --> b2 : N
+    s2 --> h : Y
+    s2 --> hd : Z
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	assert.Nil(t, ExportPlantUML(sm, &buf, nil))
+	out := buf.String()
+	assert.Contains(t, out, "    s1[H] --> a\n")
+	assert.Contains(t, out, "    s1[H*] --> b2\n")
+	assert.Contains(t, out, "  s2 --> s1[H] : Y\n")
+	assert.Contains(t, out, "  s2 --> s1[H*] : Z\n")
+
+	buf.Reset()
+	assert.Nil(t, ExportDOT(sm, &buf, nil))
+	out = buf.String()
+	assert.Contains(t, out,
+		"\t\t\"h\" [shape=circle, width=0.3, label=\"H\"];\n")
+	assert.Contains(t, out,
+		"\t\t\"hd\" [shape=circle, width=0.3, label=\"H*\"];\n")
+	assert.Contains(t, out, "\t\"s2\" -> \"hd\" [label=\"Z\"];\n")
+	assert.Contains(t, out, "\t\"hd\" -> \"b2\" [style=dashed];\n")
+}
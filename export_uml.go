@@ -0,0 +1,275 @@
+package hsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// UMLOptions controls the output of ExportMermaid() and ExportPlantUML().
+type UMLOptions struct {
+	// The title of the diagram, no title is written if empty
+	Title string
+	// Whether to highlight the current active state
+	HighlightActive bool
+}
+
+// ExportMermaid() writes the state hierarchy and declared transitions of
+// state machine sm to w as a Mermaid stateDiagram-v2. History
+// pseudo-states are rendered as states labeled "[H]" or "[H*]".
+// A nil opts is the same as a zero UMLOptions.
+func ExportMermaid(sm *StdHSM, w io.Writer, opts *UMLOptions) error {
+	return exportUML(sm, w, opts, &mermaidDialect{})
+}
+
+// ExportPlantUML() writes the state hierarchy and declared transitions of
+// state machine sm to w as a PlantUML state diagram. Transitions to
+// history pseudo-states target "s1[H]" or "s1[H*]" of their super states.
+// A nil opts is the same as a zero UMLOptions.
+func ExportPlantUML(sm *StdHSM, w io.Writer, opts *UMLOptions) error {
+	return exportUML(sm, w, opts, &plantUMLDialect{})
+}
+
+// umlDialect abstracts the syntax differences between Mermaid and PlantUML.
+type umlDialect interface {
+	// Writes the head of diagram
+	Begin(buf *bytes.Buffer, title string)
+	// Writes the tail of diagram
+	End(buf *bytes.Buffer, active string)
+	// Writes the declaration of a simple state
+	Leaf(buf *bytes.Buffer, indent, name, label string, active bool)
+	// Writes the declaration of a history pseudo-state
+	History(buf *bytes.Buffer, indent, name string, deep bool)
+	// Returns the name to refer to the history of composite state super
+	HistoryRef(super, name string, deep bool) string
+	// Returns the indentation for one level
+	Indent() string
+}
+
+// exportUML() writes the parts shared by Mermaid and PlantUML.
+func exportUML(
+	sm *StdHSM, w io.Writer, opts *UMLOptions, dialect umlDialect) error {
+
+	if opts == nil {
+		opts = &UMLOptions{}
+	}
+	e := &umlExporter{
+		sm:      sm,
+		opts:    opts,
+		dialect: dialect,
+	}
+	dialect.Begin(&e.buf, opts.Title)
+	e.writeComposite(sm.StateTable[TopStateID], 1)
+	indent := dialect.Indent()
+	for _, tran := range sm.Transitions {
+		if tran.Event == EventInit || isFinal(sm.StateTable[tran.Target]) {
+			// written inside the composite state
+			continue
+		}
+		e.writeTransition(indent, tran)
+	}
+	active := ""
+	if opts.HighlightActive && sm.State != nil {
+		active = umlName(sm.State.ID())
+	}
+	dialect.End(&e.buf, active)
+	_, err := w.Write(e.buf.Bytes())
+	return err
+}
+
+// umlExporter holds the intermediate data of exportUML().
+type umlExporter struct {
+	sm      *StdHSM
+	opts    *UMLOptions
+	dialect umlDialect
+	buf     bytes.Buffer
+}
+
+// writeComposite() writes the children, initial and final transitions
+// of composite state.
+func (self *umlExporter) writeComposite(state State, depth int) {
+	indent := strings.Repeat(self.dialect.Indent(), depth)
+	if init := self.sm.InitialOf(state.ID()); init != "" {
+		fmt.Fprintf(&self.buf, "%s[*] --> %s\n", indent, umlName(init))
+	}
+	for _, child := range state.Children() {
+		switch {
+		case child.ID() == InitialStateID:
+			// rendered as the initial transition of parent
+		case isHistory(child):
+			h := child.(*History)
+			self.dialect.History(&self.buf, indent, umlName(h.ID()), h.Deep)
+			if h.DefaultStateID != "" {
+				fmt.Fprintf(&self.buf, "%s%s --> %s\n", indent,
+					self.name(h.ID()), umlName(h.DefaultStateID))
+			}
+		case isFinal(child):
+			for _, tran := range self.sm.Transitions {
+				if tran.Target == child.ID() {
+					self.writeTransition(indent, tran)
+				}
+			}
+		case isComposite(child):
+			name := umlName(child.ID())
+			if name != child.ID() {
+				fmt.Fprintf(&self.buf, "%sstate %q as %s\n",
+					indent, child.ID(), name)
+			}
+			fmt.Fprintf(&self.buf, "%sstate %s {\n", indent, name)
+			self.writeComposite(child, depth+1)
+			fmt.Fprintf(&self.buf, "%s}\n", indent)
+		default:
+			active := self.opts.HighlightActive && child == self.sm.State
+			self.dialect.Leaf(
+				&self.buf, indent, umlName(child.ID()), child.ID(), active)
+		}
+	}
+}
+
+func (self *umlExporter) writeTransition(indent string, tran Transition) {
+	source := umlName(tran.Source)
+	label := EventName(tran.Event)
+	switch {
+	case tran.Target == "":
+		// internal transition is written as description of source state
+		fmt.Fprintf(&self.buf, "%s%s : %s / internal\n", indent, source, label)
+	case isFinal(self.sm.StateTable[tran.Target]):
+		fmt.Fprintf(&self.buf, "%s%s --> [*] : %s\n", indent, source, label)
+	default:
+		fmt.Fprintf(&self.buf, "%s%s --> %s : %s\n",
+			indent, source, self.name(tran.Target), label)
+	}
+}
+
+// name() returns the name to refer to state id in the diagram.
+func (self *umlExporter) name(id string) string {
+	if h, ok := self.sm.StateTable[id].(*History); ok {
+		return self.dialect.HistoryRef(
+			umlName(h.Super().ID()), umlName(id), h.Deep)
+	}
+	return umlName(id)
+}
+
+// isHistory() tests whether state is a history pseudo-state.
+func isHistory(state State) bool {
+	_, ok := state.(*History)
+	return ok
+}
+
+// isFinal() tests whether state is a final state.
+func isFinal(state State) bool {
+	switch s := state.(type) {
+	case *Terminal:
+		return true
+	case *defState:
+		return s.def.Final
+	}
+	return false
+}
+
+// umlName() converts state id to a name valid in Mermaid and PlantUML
+// by replacing all the characters other than letters, digits and `_'.
+func umlName(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, id)
+}
+
+// mermaidDialect is the umlDialect for Mermaid stateDiagram-v2.
+type mermaidDialect struct{}
+
+func (*mermaidDialect) Begin(buf *bytes.Buffer, title string) {
+	if title != "" {
+		fmt.Fprintf(buf, "---\ntitle: %s\n---\n", title)
+	}
+	buf.WriteString("stateDiagram-v2\n")
+}
+
+func (*mermaidDialect) End(buf *bytes.Buffer, active string) {
+	if active != "" {
+		buf.WriteString("    classDef active fill:lightblue\n")
+		fmt.Fprintf(buf, "    class %s active\n", active)
+	}
+}
+
+func (*mermaidDialect) Leaf(
+	buf *bytes.Buffer, indent, name, label string, active bool) {
+
+	if name != label {
+		fmt.Fprintf(buf, "%sstate %q as %s\n", indent, label, name)
+	} else {
+		fmt.Fprintf(buf, "%s%s\n", indent, name)
+	}
+}
+
+// History() declares the history as a state labeled "[H]" or "[H*]",
+// since Mermaid has no syntax for history pseudo-states.
+func (*mermaidDialect) History(
+	buf *bytes.Buffer, indent, name string, deep bool) {
+
+	fmt.Fprintf(buf, "%sstate \"%s\" as %s\n", indent, historyLabel(deep), name)
+}
+
+func (*mermaidDialect) HistoryRef(super, name string, deep bool) string {
+	return name
+}
+
+func (*mermaidDialect) Indent() string {
+	return "    "
+}
+
+// plantUMLDialect is the umlDialect for PlantUML state diagram.
+type plantUMLDialect struct{}
+
+func (*plantUMLDialect) Begin(buf *bytes.Buffer, title string) {
+	buf.WriteString("@startuml\n")
+	if title != "" {
+		fmt.Fprintf(buf, "title %s\n", title)
+	}
+}
+
+func (*plantUMLDialect) End(buf *bytes.Buffer, active string) {
+	buf.WriteString("@enduml\n")
+}
+
+func (*plantUMLDialect) Leaf(
+	buf *bytes.Buffer, indent, name, label string, active bool) {
+
+	fmt.Fprintf(buf, "%sstate ", indent)
+	if name != label {
+		fmt.Fprintf(buf, "%q as ", label)
+	}
+	buf.WriteString(name)
+	if active {
+		buf.WriteString(" #lightblue")
+	}
+	buf.WriteString("\n")
+}
+
+// History() declares nothing, since the history of every composite
+// state is referred as "s1[H]" or "s1[H*]" in PlantUML.
+func (*plantUMLDialect) History(
+	buf *bytes.Buffer, indent, name string, deep bool) {
+}
+
+func (*plantUMLDialect) HistoryRef(super, name string, deep bool) string {
+	return super + historyLabel(deep)
+}
+
+func (*plantUMLDialect) Indent() string {
+	return "  "
+}
+
+// historyLabel() returns "[H*]" for deep history, "[H]" for shallow one.
+func historyLabel(deep bool) string {
+	if deep {
+		return "[H*]"
+	}
+	return "[H]"
+}
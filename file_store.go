@@ -0,0 +1,175 @@
+package hsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// FileEventStore is an EventStore in files. The events are appended to
+// the log file at Path as JSON lines, and the latest snapshot is kept
+// in the file at Path + ".snapshot".
+type FileEventStore struct {
+	// The path of log file
+	Path string
+	// Whether to sync the log file on every append, true by default.
+	// The last events appended may be lost on crash if it's false.
+	Sync bool
+	file *os.File
+}
+
+// OpenFileEventStore() opens the log at path, and creates it if not exists.
+// The partial line at the end of log left by a crash is truncated,
+// so that the records appended later are not corrupted.
+func OpenFileEventStore(path string) (*FileEventStore, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end != len(data) {
+		if err := file.Truncate(int64(end)); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &FileEventStore{
+		Path: path,
+		Sync: true,
+		file: file,
+	}, nil
+}
+
+// SnapshotPath() returns the path of snapshot file.
+func (self *FileEventStore) SnapshotPath() string {
+	return self.Path + ".snapshot"
+}
+
+// Append() is part of interface EventStore.
+func (self *FileEventStore) Append(record *EventRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := self.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if self.Sync {
+		return self.file.Sync()
+	}
+	return nil
+}
+
+// Load() is part of interface EventStore. A partial line at the end of
+// log, which is left by a crash during Append(), is ignored.
+func (self *FileEventStore) Load() (*Snapshot, []*EventRecord, error) {
+	var snapshot *Snapshot
+	data, err := ioutil.ReadFile(self.SnapshotPath())
+	switch {
+	case err == nil:
+		snapshot = &Snapshot{}
+		if err := json.Unmarshal(data, snapshot); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", self.SnapshotPath(), err)
+		}
+	case !os.IsNotExist(err):
+		return nil, nil, err
+	}
+	records, err := self.readLog(snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, records, nil
+}
+
+// readLog() reads the records in log after snapshot. The records covered
+// by snapshot may remain in log if a crash happened during Compact().
+func (self *FileEventStore) readLog(snapshot *Snapshot) ([]*EventRecord, error) {
+	data, err := ioutil.ReadFile(self.Path)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	// drop the partial line, or the empty one after the last newline
+	lines = lines[:len(lines)-1]
+	var records []*EventRecord
+	for i, line := range lines {
+		record := &EventRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", self.Path, i+1, err)
+		}
+		if snapshot != nil && record.Seq <= snapshot.Seq {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// Compact() is part of interface EventStore. The snapshot is saved
+// before the log is rewritten, both by renaming a new file to be atomic.
+func (self *FileEventStore) Compact(snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(self.SnapshotPath(), data); err != nil {
+		return err
+	}
+	records, err := self.readLog(snapshot)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := self.file.Close(); err != nil {
+		return err
+	}
+	// reopen the log even if it fails to be rewritten
+	writeErr := writeFileAtomic(self.Path, buf.Bytes())
+	self.file, err = os.OpenFile(self.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// Close() is part of interface EventStore.
+func (self *FileEventStore) Close() error {
+	return self.file.Close()
+}
+
+// writeFileAtomic() replaces the file at path with data by renaming
+// a temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,162 @@
+package hsm
+
+import "sort"
+
+// The events used by the test state machine.
+const (
+	testEventA EventType = EventUser + 100 + iota
+	testEventB
+	testEventC
+	testEventD
+	testEventE
+	testEventF
+	testEventG
+	testEventH
+)
+
+func init() {
+	MustRegisterEventType(testEventA, "A")
+	MustRegisterEventType(testEventB, "B")
+	MustRegisterEventType(testEventC, "C")
+	MustRegisterEventType(testEventD, "D")
+	MustRegisterEventType(testEventE, "E")
+	MustRegisterEventType(testEventF, "F")
+	MustRegisterEventType(testEventG, "G")
+	MustRegisterEventType(testEventH, "H")
+}
+
+// testState is a table driven state used to build test state machines.
+type testState struct {
+	*StateHead
+	id string
+	// the child to transfer in Init(), empty for leaf state
+	init string
+	// the targets of transitions, empty target for internal transition
+	trans map[EventType]string
+	// where to log the actions, nil not to log
+	log *[]string
+	// whether to transfer by QTranDyn() rather than QTran()
+	dynamic bool
+}
+
+func newTestState(
+	super State, id, init string, trans map[EventType]string,
+	log *[]string) *testState {
+
+	object := &testState{
+		StateHead: NewStateHead(super),
+		id:        id,
+		init:      init,
+		trans:     trans,
+		log:       log,
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (self *testState) ID() string {
+	return self.id
+}
+
+func (self *testState) Init(sm HSM, event Event) State {
+	if self.init == "" {
+		return self.Super()
+	}
+	self.logAction("Init")
+	sm.QInit(self.init)
+	return nil
+}
+
+func (self *testState) Entry(sm HSM, event Event) State {
+	self.logAction("Entry")
+	return nil
+}
+
+func (self *testState) Exit(sm HSM, event Event) State {
+	self.logAction("Exit")
+	return nil
+}
+
+func (self *testState) logAction(action string) {
+	if self.log != nil {
+		*self.log = append(*self.log, self.id+"-"+action)
+	}
+}
+
+func (self *testState) Handle(sm HSM, event Event) State {
+	target, ok := self.trans[event.Type()]
+	if !ok {
+		return self.Super()
+	}
+	switch {
+	case target == "":
+	case self.dynamic:
+		sm.QTranDyn(target)
+	default:
+		sm.QTran(target)
+	}
+	return nil
+}
+
+// newTestHSM() builds the state machine from the book's annotated example,
+// without the guard on event H. The actions are logged into log.
+func newTestHSM(log *[]string) *StdHSM {
+	top := NewTop()
+	initial := NewInitial(top, "s0")
+	s0 := newTestState(top, "s0", "s1",
+		map[EventType]string{testEventE: "s211"}, log)
+	s1 := newTestState(s0, "s1", "s11", map[EventType]string{
+		testEventA: "s1",
+		testEventB: "s11",
+		testEventC: "s2",
+		testEventD: "s0",
+		testEventF: "s211",
+	}, log)
+	newTestState(s1, "s11", "", map[EventType]string{
+		testEventG: "s211",
+		testEventH: "",
+	}, log)
+	s2 := newTestState(s0, "s2", "s21", map[EventType]string{
+		testEventC: "s1",
+		testEventF: "s11",
+	}, log)
+	s21 := newTestState(s2, "s21", "s211", map[EventType]string{
+		testEventB: "s211",
+		testEventH: "s21",
+	}, log)
+	newTestState(s21, "s211", "", map[EventType]string{
+		testEventD: "s21",
+		testEventG: "s0",
+	}, log)
+	NewTerminal(top)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	for _, id := range []string{"s0", "s1", "s11", "s2", "s21", "s211"} {
+		s := sm.StateTable[id].(*testState)
+		events := make([]EventType, 0, len(s.trans))
+		for event := range s.trans {
+			events = append(events, event)
+		}
+		sort.Slice(events, func(i, j int) bool {
+			return events[i] < events[j]
+		})
+		if s.init != "" {
+			sm.DeclareTransition(id, EventInit, s.init)
+		}
+		for _, event := range events {
+			sm.DeclareTransition(id, event, s.trans[event])
+		}
+	}
+	return sm
+}
+
+// newDynamicTestHSM() builds the test state machine which transfers
+// dynamically.
+func newDynamicTestHSM(log *[]string) *StdHSM {
+	sm := newTestHSM(log)
+	for _, state := range sm.States {
+		if s, ok := state.(*testState); ok {
+			s.dynamic = true
+		}
+	}
+	return sm
+}
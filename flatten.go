@@ -0,0 +1,357 @@
+package hsm
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+// FlatTransition is a transition of FlatFSM, with the exit and entry
+// actions of the states on its path resolved at compile time.
+type FlatTransition struct {
+	// The guard which must hold to take this transition, nil for none
+	Guard Guard
+	// The actions of transition
+	Actions []Action
+	// The exit actions of all the states exited in order
+	Exit []Action
+	// The entry actions of all the states entered in order, including
+	// the ones of initial transitions
+	Entry []Action
+	// The index of the leaf state after transition, -1 for internal
+	// transition
+	Target int
+}
+
+// FlatFSM is a state machine flattened from Definition, see Flatten().
+// It runs the same actions as the StdHSM built from the definition,
+// but dispatches an event by a single lookup in Table, without walking
+// the state hierarchy or searching the LCA.
+type FlatFSM struct {
+	// The states indexed like StdHSM.States
+	States []State
+	// The indexes of the super states of States, -1 for top
+	Parents []int
+	// The index of current state, which is always a leaf, -1 before Init()
+	Current int
+	// The columns of event types in Table
+	Events map[EventType]int
+	// The candidate transitions in the order to try, indexed by the leaf
+	// states and the columns of event types. The rows of non-leaf states
+	// are nil.
+	Table [][][]*FlatTransition
+	// The entry actions run by Init() in order
+	InitEntry []Action
+	// The index of the leaf state after Init()
+	InitTarget int
+}
+
+// Flatten() compiles the state machine described by definition into
+// a FlatFSM. The inherited transitions of super states and the exit
+// and entry sequences of all transitions are resolved at compile time.
+// It relies on the definition alone, so the states must not change
+// the transitions declared, e.g. by calling QTran() in actions, and
+// history states, whose targets are known only at runtime, are rejected.
+func Flatten(definition *Definition, bindings *Bindings) (*FlatFSM, error) {
+	sm, err := Build(definition, bindings)
+	if err != nil {
+		return nil, err
+	}
+	var history string
+	definition.walk(func(state *StateDefinition) {
+		if state.History != "" && history == "" {
+			history = state.ID
+		}
+	})
+	if history != "" {
+		// the targets of history are known only at runtime
+		return nil, fmt.Errorf("history state %q could not be flattened",
+			history)
+	}
+	fsm := &FlatFSM{
+		States:  sm.States,
+		Parents: sm.Parents,
+		Current: -1,
+		Events:  make(map[EventType]int),
+		Table:   make([][][]*FlatTransition, len(sm.States)),
+	}
+	// the column of every event in definition, in the order of names
+	var names []string
+	definition.walk(func(state *StateDefinition) {
+		for _, tran := range state.Transitions {
+			if _, ok := fsm.Events[InternEventType(tran.Event)]; !ok {
+				fsm.Events[InternEventType(tran.Event)] = len(names)
+				names = append(names, tran.Event)
+			}
+		}
+	})
+	c := &flatCompiler{sm: sm, fsm: fsm}
+	top := sm.StateTable[TopStateID]
+	initial := sm.LookupState(sm.InitialOf(TopStateID))
+	fsm.InitEntry, fsm.InitTarget = c.enter(top, initial)
+	for i, state := range sm.States {
+		// the initial pseudo state is never current
+		if _, ok := state.(*defState); !ok || len(state.Children()) != 0 {
+			continue
+		}
+		fsm.Table[i] = make([][]*FlatTransition, len(names))
+		for _, name := range names {
+			column := fsm.Events[InternEventType(name)]
+			fsm.Table[i][column] = c.candidates(i, InternEventType(name))
+		}
+	}
+	return fsm, nil
+}
+
+// flatCompiler resolves the transitions of FlatFSM from the StdHSM built
+// from the same definition.
+type flatCompiler struct {
+	sm  *StdHSM
+	fsm *FlatFSM
+}
+
+// candidates() returns the transitions to try on the event from the leaf
+// state, which are declared in the leaf and then its super states.
+func (self *flatCompiler) candidates(leaf int, event EventType) []*FlatTransition {
+	var candidates []*FlatTransition
+	var exit []Action
+	for s := leaf; s >= 0; s = self.fsm.Parents[s] {
+		state, ok := self.sm.States[s].(*defState)
+		if !ok { // top
+			break
+		}
+		for _, tran := range state.transitions {
+			if tran.event != event {
+				continue
+			}
+			candidate := &FlatTransition{
+				Guard:   tran.guard,
+				Actions: tran.actions,
+				Target:  -1,
+			}
+			if tran.def.Target != "" {
+				target := self.sm.LookupState(tran.def.Target)
+				candidate.Exit, candidate.Entry, candidate.Target =
+					self.transfer(exit, state, target)
+			}
+			candidates = append(candidates, candidate)
+			if tran.guard == nil {
+				// the transitions after are never taken
+				return candidates
+			}
+		}
+		exit = append(exit[:len(exit):len(exit)], state.exit...)
+	}
+	return candidates
+}
+
+// transfer() resolves the transfer from source to target, after the states
+// below source are exited by actions exit. It returns the exit and entry
+// actions in order, and the index of the leaf state at last.
+func (self *flatCompiler) transfer(
+	exit []Action, source, target State) ([]Action, []Action, int) {
+
+	exit = append([]Action(nil), exit...)
+	if source == target { // transition to self
+		entry, leaf := self.enter(source.Super(), target)
+		return append(exit, exitActions(source)...), entry, leaf
+	}
+	// climb from both states by their depths to the LCA like QTranDyn()
+	s, t := self.sm.indexOf(source), self.sm.indexOf(target)
+	depths := self.sm.Depths
+	for depths[t] > depths[s] {
+		t = self.fsm.Parents[t]
+	}
+	for depths[s] > depths[t] {
+		exit = append(exit, exitActions(self.sm.States[s])...)
+		s = self.fsm.Parents[s]
+	}
+	for s != t {
+		exit = append(exit, exitActions(self.sm.States[s])...)
+		s = self.fsm.Parents[s]
+		t = self.fsm.Parents[t]
+	}
+	entry, leaf := self.enter(self.sm.States[s], target)
+	return exit, entry, leaf
+}
+
+// enter() returns the entry actions of the states from below the ancestor
+// lca down to target, and then along the initial transitions from target,
+// and the index of the leaf state at last.
+func (self *flatCompiler) enter(lca, target State) ([]Action, int) {
+	var entry []Action
+	var path []State
+	for s := target; s != lca; s = s.Super() {
+		path = append(path, s)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		entry = append(entry, entryActions(path[i])...)
+	}
+	for {
+		state, ok := target.(*defState)
+		if !ok || state.initial == "" {
+			break
+		}
+		target = self.sm.LookupState(state.initial)
+		entry = append(entry, entryActions(target)...)
+	}
+	return entry, self.sm.indexOf(target)
+}
+
+func entryActions(state State) []Action {
+	if s, ok := state.(*defState); ok {
+		return s.entry
+	}
+	return nil
+}
+
+func exitActions(state State) []Action {
+	if s, ok := state.(*defState); ok {
+		return s.exit
+	}
+	return nil
+}
+
+// Type() is part of interface HSM.
+func (self *FlatFSM) Type() HSMType {
+	return HSMTypeStd
+}
+
+// Init() is part of interface HSM.
+func (self *FlatFSM) Init() {
+	AssertEqual(-1, self.Current)
+	runActions(self.InitEntry, self, StdEvents[EventEntry])
+	self.Current = self.InitTarget
+}
+
+// Dispatch() is part of interface HSM. It takes the first transition
+// in Table whose guard holds, and ignores the event if there is none.
+func (self *FlatFSM) Dispatch(event Event) {
+	column, ok := self.Events[event.Type()]
+	if !ok {
+		return
+	}
+	for _, tran := range self.Table[self.Current][column] {
+		if tran.Guard != nil && !tran.Guard(self, event) {
+			continue
+		}
+		runActions(tran.Actions, self, event)
+		if tran.Target >= 0 {
+			runActions(tran.Exit, self, StdEvents[EventExit])
+			self.Current = tran.Target
+			runActions(tran.Entry, self, StdEvents[EventEntry])
+		}
+		return
+	}
+}
+
+// GetState() is part of interface HSM.
+func (self *FlatFSM) GetState() State {
+	return self.States[self.Current]
+}
+
+// IsIn() is part of interface HSM.
+func (self *FlatFSM) IsIn(stateID string) bool {
+	for s := self.Current; s >= 0; s = self.Parents[s] {
+		if self.States[s].ID() == stateID {
+			return true
+		}
+	}
+	return false
+}
+
+// QInit() is part of interface HSM. The transitions of FlatFSM are all
+// compiled from definition, so it must not be called, nor QTran*().
+func (self *FlatFSM) QInit(targetStateID string) {
+	AssertTrue(false)
+}
+
+// QTran() is part of interface HSM, which must not be called.
+func (self *FlatFSM) QTran(targetStateID string) {
+	AssertTrue(false)
+}
+
+// QTranOnEvent() is part of interface HSM, which must not be called.
+func (self *FlatFSM) QTranOnEvent(targetStateID string, event Event) {
+	AssertTrue(false)
+}
+
+// QTranDyn() is part of interface HSM, which must not be called.
+func (self *FlatFSM) QTranDyn(targetStateID string) {
+	AssertTrue(false)
+}
+
+// QTranDynOnEvent() is part of interface HSM, which must not be called.
+func (self *FlatFSM) QTranDynOnEvent(targetStateID string, event Event) {
+	AssertTrue(false)
+}
+
+// VerifyFlatten() runs the StdHSM built from definition and the FlatFSM
+// flattened from it side by side on n random events in definition,
+// and returns an error on the first divergence of their current states
+// or the actions run. bindings is called once for each of them,
+// so that they don't share extended states.
+func VerifyFlatten(definition *Definition, bindings func() *Bindings,
+	n int, seed int64) error {
+
+	var log, flatLog []string
+	sm, err := Build(definition, recordBindings(bindings(), &log))
+	if err != nil {
+		return err
+	}
+	fsm, err := Flatten(definition, recordBindings(bindings(), &flatLog))
+	if err != nil {
+		return err
+	}
+	var events []string
+	for event := range fsm.Events {
+		events = append(events, EventName(event))
+	}
+	sort.Strings(events)
+	check := func(step string) error {
+		if sm.GetState().ID() != fsm.GetState().ID() ||
+			!reflect.DeepEqual(log, flatLog) {
+			return fmt.Errorf("diverged on %s: %s %v by hsm, %s %v by flat",
+				step, sm.GetState().ID(), log, fsm.GetState().ID(), flatLog)
+		}
+		log, flatLog = nil, nil
+		return nil
+	}
+	sm.Init()
+	fsm.Init()
+	if err := check("init"); err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	random := rand.New(rand.NewSource(seed))
+	for i := 0; i < n; i++ {
+		name := events[random.Intn(len(events))]
+		event := StdEventOf(InternEventType(name))
+		sm.Dispatch(event)
+		fsm.Dispatch(event)
+		if err := check(fmt.Sprintf("event %d %s", i+1, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordBindings() returns a copy of bindings whose actions log their
+// names into log before running.
+func recordBindings(bindings *Bindings, log *[]string) *Bindings {
+	recorded := NewBindings()
+	for name, action := range bindings.Actions {
+		name, action := name, action
+		recorded.BindAction(name, func(sm HSM, event Event) {
+			*log = append(*log, name)
+			action(sm, event)
+		})
+	}
+	for name, guard := range bindings.Guards {
+		recorded.BindGuard(name, guard)
+	}
+	return recorded
+}
@@ -0,0 +1,160 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// testAnnotatedJSON is the annotated example with entry and exit actions
+// on every state, and guards on event H.
+const testAnnotatedJSON = `
+{
+  "name": "annotated",
+  "initial": "s0",
+  "states": [
+    {
+      "id": "s0",
+      "entry": ["s0Entry"],
+      "exit": ["s0Exit"],
+      "transitions": [
+        {"event": "E", "target": "s211"},
+        {"event": "I", "actions": ["toggle"]}
+      ],
+      "states": [
+        {
+          "id": "s1",
+          "entry": ["s1Entry"],
+          "exit": ["s1Exit"],
+          "transitions": [
+            {"event": "A", "target": "s1"},
+            {"event": "B", "target": "s11"},
+            {"event": "C", "target": "s2"},
+            {"event": "D", "target": "s0"},
+            {"event": "F", "target": "s211"}
+          ],
+          "states": [
+            {
+              "id": "s11",
+              "entry": ["s11Entry"],
+              "exit": ["s11Exit"],
+              "transitions": [
+                {"event": "G", "target": "s211"},
+                {"event": "H", "guard": "foo", "actions": ["toggle"]}
+              ]
+            }
+          ]
+        },
+        {
+          "id": "s2",
+          "entry": ["s2Entry"],
+          "exit": ["s2Exit"],
+          "transitions": [
+            {"event": "C", "target": "s1"},
+            {"event": "F", "target": "s11"}
+          ],
+          "states": [
+            {
+              "id": "s21",
+              "entry": ["s21Entry"],
+              "exit": ["s21Exit"],
+              "transitions": [
+                {"event": "B", "target": "s211"},
+                {"event": "H", "guard": "notFoo", "target": "s21", "actions": ["toggle"]}
+              ],
+              "states": [
+                {
+                  "id": "s211",
+                  "entry": ["s211Entry"],
+                  "exit": ["s211Exit"],
+                  "transitions": [
+                    {"event": "D", "target": "s21"},
+                    {"event": "G", "target": "s0"},
+                    {"event": "H", "guard": "foo", "target": "s0"}
+                  ]
+                }
+              ]
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`
+
+// newAnnotatedBindings() binds the actions of testAnnotatedJSON, where
+// toggle flips foo.
+func newAnnotatedBindings() *Bindings {
+	bindings := NewBindings()
+	definition, _ := readTestDefinition(testAnnotatedJSON)
+	foo := false
+	for _, name := range definition.ActionNames() {
+		bindings.BindAction(name, func(sm HSM, event Event) {})
+	}
+	bindings.Actions["toggle"] = func(sm HSM, event Event) {
+		foo = !foo
+	}
+	return bindings.
+		BindGuard("foo", func(sm HSM, event Event) bool {
+			return foo
+		}).
+		BindGuard("notFoo", func(sm HSM, event Event) bool {
+			return !foo
+		})
+}
+
+func readAnnotatedDefinition(t *testing.T) *Definition {
+	definition, err := readTestDefinition(testAnnotatedJSON)
+	assert.Nil(t, err)
+	return definition
+}
+
+func TestFlatten(t *testing.T) {
+	var log []string
+	definition := readAnnotatedDefinition(t)
+	fsm, err := Flatten(definition,
+		recordBindings(newAnnotatedBindings(), &log))
+	assert.Nil(t, err)
+	fsm.Init()
+	assert.Equal(t, "s11", fsm.GetState().ID())
+	assert.Equal(t, []string{"s0Entry", "s1Entry", "s11Entry"}, log)
+	// inherited from s1
+	log = nil
+	fsm.Dispatch(StdEventOf(InternEventType("C")))
+	assert.Equal(t, "s211", fsm.GetState().ID())
+	assert.Equal(t, []string{
+		"s11Exit", "s1Exit", "s2Entry", "s21Entry", "s211Entry"}, log)
+	assert.True(t, fsm.IsIn("s2"))
+	assert.False(t, fsm.IsIn("s1"))
+	// transition to the ancestor s21, which is not exited
+	log = nil
+	fsm.Dispatch(StdEventOf(InternEventType("D")))
+	assert.Equal(t, []string{"s211Exit", "s211Entry"}, log)
+	// the guard of s211 fails, and then s21 transfers to itself
+	log = nil
+	fsm.Dispatch(StdEventOf(InternEventType("H")))
+	assert.Equal(t, []string{
+		"toggle", "s211Exit", "s21Exit", "s21Entry", "s211Entry"}, log)
+	// A is handled by none of s211 and its super states
+	log = nil
+	fsm.Dispatch(StdEventOf(testEventA))
+	assert.Equal(t, "s211", fsm.GetState().ID())
+	// the guard of s211 holds now
+	fsm.Dispatch(StdEventOf(InternEventType("H")))
+	assert.Equal(t, []string{
+		"s211Exit", "s21Exit", "s2Exit", "s1Entry", "s11Entry"}, log)
+	assert.Equal(t, "s11", fsm.GetState().ID())
+}
+
+func TestVerifyFlatten(t *testing.T) {
+	definition := readAnnotatedDefinition(t)
+	assert.Nil(t, VerifyFlatten(definition, newAnnotatedBindings, 5000, 1))
+	// the engines diverge if they share the extended state
+	shared := newAnnotatedBindings()
+	err := VerifyFlatten(definition, func() *Bindings {
+		return shared
+	}, 5000, 1)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "diverged on event "))
+}
@@ -1,7 +1,7 @@
 package hsm
 
 import (
-	"container/list"
+	"context"
 )
 
 type HSMType uint32
@@ -44,18 +44,41 @@ type HSM interface {
 	QTranDynOnEvent(targetStateID string, event Event)
 }
 
+// StaticTranID identifies a static transfer by the IDs of its source
+// and target states.
+//
+// Deprecated: the chains are keyed by the indexes of states in TranCache,
+// StaticTranID is only used by StdHSM.StaticTrans().
 type StaticTranID struct {
 	SourceState string
 	TargetState string
 }
 
+// StaticTranAction is a step in StaticTranChain.
 type StaticTranAction struct {
-	State State
-	Event Event
+	// The index of state in StdHSM.States
+	State int
+	// The callback to trigger: EventInit, EventEntry or EventExit
+	Event EventType
+	// Whether the callback was handled when recorded
+	Handled bool
 }
 
+// StaticTranChain is the steps recorded for a static transfer
+// from source to target, which are replayed without searching the LCA.
 type StaticTranChain struct {
-	Actions *list.List
+	Actions []StaticTranAction
+	// The index of current state when the chain is done
+	Target int
+	// Whether the initial transitions from Target are not recorded,
+	// but run dynamically after the chain, see Precompile()
+	DynamicInit bool
+	// Whether Handled of the actions are recorded. It's false for
+	// a precompiled chain until it's replayed for the first time.
+	Recorded bool
+	// Whether the callbacks on the path are found non-deterministic,
+	// so that the transfer is run dynamically instead of the chain
+	Dynamic bool
 }
 
 // StdHSM is the default HSM implementation.
@@ -70,8 +93,47 @@ type StdHSM struct {
 	State State
 	// The global map for all states and their names in this state machine
 	StateTable map[string]State
-	// The transfer action chains cached for static transfers
-	StaticTrans map[StaticTranID]*StaticTranChain
+	// All the states indexed by their indexes, see indexOf()
+	States []State
+	// The indexes of the states which don't embed StateHead
+	Indexes map[State]int
+	// The indexes of the super states of States, -1 for top
+	Parents []int
+	// The depths of States in the hierarchy, 0 for top
+	Depths []int
+	// The transitions declared for this state machine
+	Transitions []Transition
+	// The observers notified of the activities in this state machine
+	Observers []Observer
+	// Whether the events are replayed from a journal, see IsReplaying()
+	Replaying bool
+	// The version of the definition of this state machine
+	DefinitionVersion int
+	// The migrations of snapshots taken from older definition versions
+	Migrations []*Migration
+	// The context of the event being dispatched, see ContextOf()
+	Context context.Context
+	// The events posted to be dispatched after the current one
+	Queue []Event
+	// How to recover from panics in dispatching, nil not to recover
+	Recovery *RecoveryPolicy
+	// Whether to roll back the transitions failed, see TryEntry
+	Transactional bool
+	// The TransitionError of the last event dispatched in transactional mode
+	Err error
+	// the transaction of the event being dispatched in transactional mode
+	tx *transaction
+	// the cache of static transfer chains, see SetTranCache()
+	tranCache TranCache
+	// the buffer of the path entered in dynamic transfers
+	path []State
+	// the history pseudo-states by their super states
+	histories map[State][]*History
+	// whether the events in Queue are being dispatched, see drain()
+	draining bool
+	// the deepest state entered and not exited yet in dispatching, which
+	// differs from State in the middle of a transition, see recover()
+	active State
 }
 
 // Constructor for StdHSM. The initial must set top as parent state.
@@ -83,11 +145,11 @@ func NewStdHSM(myType HSMType, top, initial State) *StdHSM {
 		SourceState: initial,
 		State:       top,
 		StateTable:  make(map[string]State),
-		StaticTrans: make(map[StaticTranID]*StaticTranChain),
+		Indexes:     make(map[State]int),
+		tranCache:   NewUnboundedTranCache(),
 	}
-	hsm.StateTable[top.ID()] = top
 	// setup state table
-	hsm.setupStateTable()
+	hsm.setupStateTable(top)
 	return hsm
 }
 
@@ -96,19 +158,43 @@ func (self *StdHSM) Type() HSMType {
 }
 
 // setupStateTable() initializes StateTable properly
-// with all states and their names.
-func (self *StdHSM) setupStateTable() {
-	for traverse_queue := self.State.Children(); len(traverse_queue) != 0; {
+// with all states and their names, and indexes them from top.
+func (self *StdHSM) setupStateTable(top State) {
+	depth := 0
+	self.histories = nil
+	for traverse_queue := []State{top}; len(traverse_queue) != 0; {
 		state := traverse_queue[0]
 		traverse_queue = traverse_queue[1:]
 		_, ok := self.StateTable[state.ID()]
 		AssertFalse(ok)
 		self.StateTable[state.ID()] = state
+		self.setIndex(state, len(self.States))
+		self.States = append(self.States, state)
+		// the super state is always indexed before its children
+		if super := state.Super(); super != nil {
+			parent := self.indexOf(super)
+			self.Parents = append(self.Parents, parent)
+			self.Depths = append(self.Depths, self.Depths[parent]+1)
+		} else {
+			self.Parents = append(self.Parents, -1)
+			self.Depths = append(self.Depths, 0)
+		}
+		if d := self.Depths[len(self.Depths)-1]; d > depth {
+			depth = d
+		}
+		if h, ok := state.(*History); ok {
+			if self.histories == nil {
+				self.histories = make(map[State][]*History)
+			}
+			self.histories[h.Super()] = append(self.histories[h.Super()], h)
+		}
 		children := state.Children()
 		for _, state := range children {
 			traverse_queue = append(traverse_queue, state)
 		}
 	}
+	// a path entered never includes top
+	self.path = make([]State, 0, depth)
 }
 
 // Init() is part of interface HSM.
@@ -144,6 +230,7 @@ func (self *StdHSM) Init2(hsm HSM, event Event) {
 		TriggerEntry(hsm, s, StdEvents[EventEntry])
 	}
 	// we are in well-initialized state now
+	self.drain(hsm, context.Background())
 }
 
 // Dispatch() is part of interface HSM.
@@ -152,12 +239,45 @@ func (self *StdHSM) Dispatch(event Event) {
 }
 
 // Dispatch2() is a helper function to dispatch event to the concrete HSM.
+// The events posted during dispatching are dispatched after it in order.
 func (self *StdHSM) Dispatch2(hsm HSM, event Event) {
+	self.DispatchContext2(hsm, context.Background(), event)
+}
+
+// dispatch() runs the run-to-completion step of event.
+func (self *StdHSM) dispatch(hsm HSM, event Event) {
+	if self.Recovery != nil {
+		self.active = self.State
+		defer self.recover(hsm, event, self.State, len(self.Queue))
+	}
+	if self.Transactional {
+		self.begin()
+		defer self.commit(hsm, event)
+	}
 	// Use `SourceState' to record the state which handle the event indeed(which
 	// could be super, super-super, ... state).
 	// `State' would stay unchange pointing at the current(most concrete) state.
 	for self.SourceState = self.State; self.SourceState != nil; {
-		self.SourceState = Trigger(hsm, self.SourceState, event)
+		if event.Type() <= EventExit {
+			self.SourceState = Trigger(hsm, self.SourceState, event)
+			continue
+		}
+		state := self.SourceState
+		s, err := TriggerHandleErr(hsm, state, event)
+		if err != nil {
+			// deliver the error to the super states
+			event = &ErrorEvent{
+				Err:     err,
+				Event:   event,
+				StateID: state.ID(),
+			}
+			s = state.Super()
+		} else if s == nil && state.Super() == nil {
+			if e, ok := event.(*ErrorEvent); ok {
+				self.Warn("unhandled %v", e)
+			}
+		}
+		self.SourceState = s
 	}
 }
 
@@ -179,7 +299,7 @@ func (self *StdHSM) isIn(state State) bool {
 	// nagivate from current state up to all super state and
 	// try to find specified `state'
 	s := self.State
-	for ; s != nil; s = Trigger(self, self.State, StdEvents[EventEmpty]) {
+	for ; s != nil; s = Trigger(self, s, StdEvents[EventEmpty]) {
 		if s == state {
 			// a match is found
 			return true
@@ -202,7 +322,8 @@ func (self *StdHSM) qinit(state State) {
 
 // LookupState() search the specified state in state/name map.
 func (self *StdHSM) LookupState(targetStateID string) State {
-	AssertNotEqual(TopStateID, targetStateID)
+	// compare directly rather than AssertNotEqual() which boxes the strings
+	AssertTrue(targetStateID != TopStateID)
 	target, ok := self.StateTable[targetStateID]
 	AssertTrue(ok)
 	return target
@@ -237,6 +358,7 @@ func (self *StdHSM) QTranHSMOnEvent(hsm HSM, target State, event Event) {
 func (self *StdHSM) QTranHSMOnEvents(
 	hsm HSM, target State, entryEvent, initEvent, exitEvent Event) {
 
+	target = self.resume(target)
 	for s := self.State; s != self.SourceState; {
 		// we are about to dereference `s'
 		AssertNotEqual(nil, s)
@@ -248,56 +370,126 @@ func (self *StdHSM) QTranHSMOnEvents(
 		}
 	}
 
-	id := StaticTranID{
-		SourceState: self.SourceState.ID(),
-		TargetState: target.ID(),
-	}
-	chain, ok := self.StaticTrans[id]
-	if !ok { // is the transfer chain initialized?
+	source, index := self.indexOf(self.SourceState), self.indexOf(target)
+	chain := self.tranCache.Get(source, index)
+	if chain == nil { // is the transfer chain initialized?
 		// setup the transition
-		chain := self.QTranSetup(hsm, target, entryEvent, initEvent, exitEvent)
-		self.StaticTrans[id] = chain
-	} else { // transition initialized, execute transition chain
-		var action *StaticTranAction
-		var ok bool
-		for e := chain.Actions.Front(); e != nil; e = e.Next() {
-			action, ok = e.Value.(*StaticTranAction)
-			AssertTrue(ok)
-			if action.Event.Type() == EventEmpty {
-				// stop at the sentinal
-				break
-			}
-			switch action.Event.Type() {
-			case EventInit:
-				action.State.Init(hsm, initEvent)
-			case EventEntry:
-				action.State.Entry(hsm, entryEvent)
-			case EventExit:
-				action.State.Exit(hsm, exitEvent)
-			default:
-				// malformed static transfer chain
-				AssertTrue(false)
+		chain = self.QTranSetup(hsm, target, entryEvent, initEvent, exitEvent)
+		self.tranCache.Put(source, index, chain)
+		return
+	}
+	if chain.Dynamic {
+		self.qtranDyn(hsm, target, entryEvent, initEvent, exitEvent)
+		return
+	}
+	// transition initialized, execute transition chain
+	self.replay(hsm, target, chain, entryEvent, initEvent, exitEvent)
+}
+
+// replay() executes the transition chain to target, and verifies that every callback
+// is handled or not as it was recorded, and that every initial transition
+// goes to the same substate. On mismatch, the chain is marked Dynamic
+// with a warning, and the rest of an initial transition is run dynamically.
+func (self *StdHSM) replay(
+	hsm HSM,
+	target State,
+	chain *StaticTranChain,
+	entryEvent, initEvent, exitEvent Event) {
+
+	for i := range chain.Actions {
+		action := &chain.Actions[i]
+		state := self.States[action.State]
+		var handled bool
+		switch action.Event {
+		case EventInit:
+			self.State = state
+			handled = TriggerInit(hsm, state, initEvent) == nil
+			// a handled initial transition is recorded with the entry
+			// of the substate after it
+			if handled != action.Handled ||
+				(handled && self.State != self.States[chain.Actions[i+1].State]) {
+				self.diverge(target, chain, action, handled)
+				if handled {
+					// initial transition must go *one* level deep
+					AssertEqual(state, Trigger(hsm, self.State, StdEvents[EventEmpty]))
+					TriggerEntry(hsm, self.State, entryEvent) // enter the substate
+					self.qinitDyn(hsm, self.State, entryEvent, initEvent)
+				}
+				return
 			}
+			continue
+		case EventEntry:
+			handled = TriggerEntry(hsm, state, entryEvent) == nil
+		case EventExit:
+			handled = TriggerExit(hsm, state, exitEvent) == nil
+		default:
+			// malformed static transfer chain
+			AssertTrue(false)
+		}
+		if !chain.Recorded {
+			action.Handled = handled
+		} else if handled != action.Handled {
+			self.diverge(target, chain, action, handled)
+		}
+	}
+	chain.Recorded = true
+	self.State = self.States[chain.Target]
+	if chain.DynamicInit {
+		self.qinitDyn(hsm, self.State, entryEvent, initEvent)
+	}
+}
+
+// diverge() marks the chain to target Dynamic, and warns of the callback
+// of action
+// which is found non-deterministic.
+func (self *StdHSM) diverge(
+	target State, chain *StaticTranChain, action *StaticTranAction,
+	handled bool) {
+
+	if chain.Dynamic {
+		return
+	}
+	chain.Dynamic = true
+	outcome := func(handled bool) string {
+		if handled {
+			return "handled"
 		}
-		self.State = action.State
+		return "unhandled"
 	}
+	self.Warn("non-deterministic %s-%s, %s but %s when recorded: "+
+		"transition from %s to %s falls back to dynamic",
+		self.States[action.State].ID(), EventName(action.Event),
+		outcome(handled), outcome(action.Handled),
+		self.SourceState.ID(), target.ID())
 }
 
+// qinitDyn() runs the initial transitions from target, which is
+// the current state, down to a leaf state.
+func (self *StdHSM) qinitDyn(hsm HSM, target State, entryEvent, initEvent Event) {
+	for TriggerInit(hsm, target, initEvent) == nil {
+		// initial transition must go *one* level deep
+		AssertEqual(target, Trigger(hsm, self.State, StdEvents[EventEmpty]))
+		target = self.State
+		TriggerEntry(hsm, target, entryEvent) // enter target
+	}
+}
+
+// QTranSetup() runs the transfer from SourceState to target, and records
+// the steps taken into the chain returned.
 func (self *StdHSM) QTranSetup(
 	hsm HSM,
 	target State,
 	entryEvent, initEvent, exitEvent Event) *StaticTranChain {
 
-	// action list for this static transfer that would be cached for hsm
-	actions := list.New()
-	// state list only for this static transfer setup process
-	stateChain := list.New()
-	stateChain.PushBack(target) // assume entry to target
+	// action chain for this static transfer that would be cached for hsm
+	chain := &StaticTranChain{}
+	// states to enter in reverse order only for this setup process
+	stateChain := []State{target} // assume entry to target
 
 	var p, q, s State
 	// (a) check `SourceState' == `target' (transition to self)
 	if self.SourceState == target {
-		RecordExit(actions, hsm, self.SourceState, exitEvent) // exit source
+		self.record(chain, EventExit, hsm, self.SourceState, exitEvent) // exit source
 		goto inLCA
 	}
 	// (b) check `SourceState' == `target.Super()'
@@ -308,75 +500,115 @@ func (self *StdHSM) QTranSetup(
 	// (c) check `SourceState.Super()' == `target.Super()' (most common)
 	q = Trigger(hsm, self.SourceState, StdEvents[EventEmpty])
 	if q == p {
-		RecordExit(actions, hsm, self.SourceState, exitEvent) // exit source
+		self.record(chain, EventExit, hsm, self.SourceState, exitEvent) // exit source
 		goto inLCA
 	}
 	// (d) check `SourceState.Super()' == `target'
 	if q == target {
-		RecordExit(actions, hsm, self.SourceState, exitEvent) // exit source
-		stateChain.Remove(stateChain.Back())                  // do not enter the LCA
+		self.record(chain, EventExit, hsm, self.SourceState, exitEvent) // exit source
+		stateChain = stateChain[:0]                                     // do not enter the LCA
 		goto inLCA
 	}
 	// (e) check rest of `SourceState' == `target.Super().Super()...' hierarchy
-	stateChain.PushBack(p)
+	stateChain = append(stateChain, p)
 	s = Trigger(hsm, p, StdEvents[EventEmpty])
 	for s != nil {
 		if self.SourceState == s {
 			goto inLCA
 		}
-		stateChain.PushBack(s)
+		stateChain = append(stateChain, s)
 		s = Trigger(hsm, s, StdEvents[EventEmpty])
 	}
 	// exit source state
-	RecordExit(actions, hsm, self.SourceState, exitEvent)
+	self.record(chain, EventExit, hsm, self.SourceState, exitEvent)
 	// (f) check rest of `SourceState.Super()' == `target.Super().Super()...'
-	for lca := stateChain.Back(); lca != nil; lca = lca.Prev() {
-		if q == lca.Value {
+	for i := len(stateChain) - 1; i >= 0; i-- {
+		if q == stateChain[i] {
 			// do not enter the LCA
-			stateChain = ListTruncate(stateChain, lca)
+			stateChain = stateChain[:i]
 			goto inLCA
 		}
 	}
 	// (g) check each `SourceState.Super().Super()...' for target...
 	for s = q; s != nil; s = Trigger(hsm, s, StdEvents[EventEmpty]) {
-		for lca := stateChain.Back(); lca != nil; lca = lca.Prev() {
-			if s == lca.Value {
+		for i := len(stateChain) - 1; i >= 0; i-- {
+			if s == stateChain[i] {
 				// do not entry the LCA
-				stateChain = ListTruncate(stateChain, lca)
+				stateChain = stateChain[:i]
 				goto inLCA
 			}
 		}
-		RecordExit(actions, hsm, s, exitEvent)
+		self.record(chain, EventExit, hsm, s, exitEvent)
 	}
 	// malformed HSM
 	AssertTrue(false)
 inLCA: // now we are in the LCA of `SourceState' and `target'
 	// retrace the entry path in reverse order
-	for e := stateChain.Back(); e != nil; e = e.Prev() {
-		s, ok := e.Value.(State)
-		AssertTrue(ok)
-		RecordEntry(actions, hsm, s, entryEvent) // enter `s' state
+	for i := len(stateChain) - 1; i >= 0; i-- {
+		self.record(chain, EventEntry, hsm, stateChain[i], entryEvent) // enter `s' state
 	}
 	// update current state
 	self.State = target
 	for TriggerInit(hsm, target, initEvent) == nil {
 		// initial transition must go *one* level deep
 		AssertEqual(target, Trigger(hsm, self.State, StdEvents[EventEmpty]))
-		action := &StaticTranAction{
-			State: target,
-			Event: StdEvents[EventInit],
-		}
-		actions.PushBack(action)
+		chain.Actions = append(chain.Actions, StaticTranAction{
+			State:   self.indexOf(target),
+			Event:   EventInit,
+			Handled: true,
+		})
 		target = self.State
-		RecordEntry(actions, hsm, target, entryEvent) // enter target
+		self.record(chain, EventEntry, hsm, target, entryEvent) // enter target
 	}
-	action := &StaticTranAction{
-		State: target,
-		Event: StdEvents[EventEmpty], // use empty event as a stop sentinal
+	// the unhandled initial transition is verified on replay as well
+	chain.Actions = append(chain.Actions, StaticTranAction{
+		State: self.indexOf(target),
+		Event: EventInit,
+	})
+	chain.Target = self.indexOf(target)
+	chain.Recorded = true
+	return chain
+}
+
+// record() triggers the callback of kind on state, and appends it to chain
+// along with whether it's handled. The unhandled ones are recorded too,
+// since they may be handled on replay.
+func (self *StdHSM) record(
+	chain *StaticTranChain, kind EventType, hsm HSM, state State, event Event) {
+
+	var s State
+	switch kind {
+	case EventEntry:
+		s = TriggerEntry(hsm, state, event)
+	case EventExit:
+		s = TriggerExit(hsm, state, event)
+	default:
+		// invalid call
+		AssertTrue(false)
+	}
+	chain.Actions = append(chain.Actions, StaticTranAction{
+		State:   self.indexOf(state),
+		Event:   kind,
+		Handled: s == nil,
+	})
+}
+
+// indexOf() returns the index of state in States.
+func (self *StdHSM) indexOf(state State) int {
+	if s, ok := state.(indexed); ok {
+		return s.stateIndex()
 	}
-	actions.PushBack(action)
-	return &StaticTranChain{
-		Actions: actions,
+	index, ok := self.Indexes[state]
+	AssertTrue(ok)
+	return index
+}
+
+// setIndex() sets the index of state in States.
+func (self *StdHSM) setIndex(state State, index int) {
+	if s, ok := state.(indexed); ok {
+		s.setStateIndex(index)
+	} else {
+		self.Indexes[state] = index
 	}
 }
 
@@ -416,7 +648,7 @@ func (self *StdHSM) QTranDynHSMOnEvent(hsm HSM, target State, event Event) {
 func (self *StdHSM) QTranDynHSMOnEvents(
 	hsm HSM, target State, entryEvent, initEvent, exitEvent Event) {
 
-	var p, q, s State
+	target = self.resume(target)
 	for s := self.State; s != self.SourceState; {
 		// we are about to dereference `s'
 		AssertNotEqual(nil, s)
@@ -427,77 +659,75 @@ func (self *StdHSM) QTranDynHSMOnEvents(
 			s = Trigger(hsm, s, StdEvents[EventEmpty])
 		}
 	}
+	self.qtranDyn(hsm, target, entryEvent, initEvent, exitEvent)
+}
 
-	stateChain := list.New()
-	stateChain.PushBack(target) // assume entry to target
-
-	// (a) check `SourceState' == `target' (transition to self)
-	if self.SourceState == target {
-		TriggerExit(hsm, self.SourceState, exitEvent) // exit source
-		goto inLCA
-	}
-	// (b) check `SourceState' == `target.Super()'
-	p = Trigger(hsm, target, StdEvents[EventEmpty])
-	if self.SourceState == p {
-		goto inLCA
+// resume() returns the state resumed by the history target, or target
+// itself if it's not a history.
+func (self *StdHSM) resume(target State) State {
+	if h, ok := target.(*History); ok {
+		return self.LookupState(h.Resume())
 	}
-	// (c) check `SourceState.Super()' == `target.Super()' (most common)
-	q = Trigger(hsm, self.SourceState, StdEvents[EventEmpty])
-	if q == p {
-		TriggerExit(hsm, self.SourceState, exitEvent) // exit source
-		goto inLCA
+	return target
+}
+
+// exited() records the history of state when it's exited.
+func (self *StdHSM) exited(state State) {
+	self.active = state.Super()
+	if self.tx != nil {
+		self.tx.exited = append(self.tx.exited, state)
 	}
-	// (d) check `SourceState.Super()' == `target'
-	if q == target {
-		TriggerExit(hsm, self.SourceState, exitEvent) // exit source
-		stateChain.Remove(stateChain.Back())          // do not enter the LCA
-		goto inLCA
+	if self.histories == nil {
+		return
 	}
-	// (e) check rest of `SourceState' == `target.Super().Super()...'  hierarchy
-	stateChain.PushBack(p)
-	s = Trigger(hsm, p, StdEvents[EventEmpty])
-	for s != nil {
-		if self.SourceState == s {
-			goto inLCA
+	for _, h := range self.histories[state] {
+		if self.tx != nil {
+			self.tx.touch(h)
 		}
-		stateChain.PushBack(s)
-		s = Trigger(hsm, s, StdEvents[EventEmpty])
+		h.record(self.State)
 	}
-	TriggerExit(hsm, self.SourceState, exitEvent) // exit source state
-	// (f) check rest of `SourceState.Super()' == `target.Super().Super()...'
-	for lca := stateChain.Back(); lca != nil; lca = lca.Prev() {
-		if q == lca.Value {
-			// do not enter the LCA
-			stateChain = ListTruncate(stateChain, lca)
-			goto inLCA
+}
+
+// entered() records state as the deepest state entered.
+func (self *StdHSM) entered(state State) {
+	self.active = state
+}
+
+// qtranDyn() runs the transfer from SourceState to target dynamically,
+// after the states below SourceState are exited.
+func (self *StdHSM) qtranDyn(
+	hsm HSM, target State, entryEvent, initEvent, exitEvent Event) {
+
+	if self.SourceState == target { // transition to self
+		TriggerExit(hsm, target, exitEvent)
+		TriggerEntry(hsm, target, entryEvent)
+	} else {
+		// climb from both states by their depths to the LCA, exiting
+		// the source path and collecting the target path
+		s, t := self.indexOf(self.SourceState), self.indexOf(target)
+		path := self.path[:0]
+		for self.Depths[t] > self.Depths[s] {
+			path = append(path, self.States[t])
+			t = self.Parents[t]
 		}
-	}
-	// (g) check each `SourceState.Super().Super()...' for target...
-	for s = q; s != nil; s = Trigger(hsm, s, StdEvents[EventEmpty]) {
-		for lca := stateChain.Back(); lca != nil; lca = lca.Prev() {
-			if s == lca.Value {
-				// do not entry the LCA
-				stateChain = ListTruncate(stateChain, lca)
-				goto inLCA
-			}
+		for self.Depths[s] > self.Depths[t] {
+			TriggerExit(hsm, self.States[s], exitEvent)
+			s = self.Parents[s]
+		}
+		for s != t {
+			TriggerExit(hsm, self.States[s], exitEvent)
+			s = self.Parents[s]
+			path = append(path, self.States[t])
+			t = self.Parents[t]
+		}
+		// now we are in the LCA of `SourceState' and `target',
+		// retrace the entry path in reverse order
+		for i := len(path) - 1; i >= 0; i-- {
+			TriggerEntry(hsm, path[i], entryEvent)
+			path[i] = nil
 		}
-		TriggerExit(hsm, s, exitEvent)
-	}
-	// malformed HSM
-	AssertTrue(false)
-inLCA: // now we are in the LCA of `SourceState' and `target'
-	// retrace the entry path in reverse order
-	for e := stateChain.Back(); e != nil; e = e.Prev() {
-		s, ok := e.Value.(State)
-		AssertTrue(ok)
-		TriggerEntry(hsm, s, entryEvent) // enter `s' state
 	}
 	// update current state
 	self.State = target
-	for TriggerInit(hsm, target, initEvent) == nil {
-		// initial transition must go *one* level deep
-		AssertEqual(target, Trigger(hsm, self.State, StdEvents[EventEmpty]))
-		target = self.State
-		TriggerEntry(hsm, target, entryEvent) // enter target
-	}
+	self.qinitDyn(hsm, target, entryEvent, initEvent)
 }
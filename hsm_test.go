@@ -0,0 +1,45 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+func TestDynamicTransitionNoAllocation(t *testing.T) {
+	sm := newDynamicTestHSM(nil)
+	sm.Init()
+	events := []Event{
+		StdEventOf(testEventC), StdEventOf(testEventE),
+		StdEventOf(testEventG), StdEventOf(testEventF),
+	}
+	// warm up the queue of events
+	sm.Dispatch(events[0])
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, event := range events {
+			sm.Dispatch(event)
+		}
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func TestDynamicTransitionEquivalence(t *testing.T) {
+	var log, dynamicLog []string
+	sm := newTestHSM(&log)
+	dynamic := newDynamicTestHSM(&dynamicLog)
+	sm.Init()
+	dynamic.Init()
+	events := []EventType{
+		testEventA, testEventB, testEventC, testEventD,
+		testEventE, testEventF, testEventG, testEventH,
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		event := StdEventOf(events[random.Intn(len(events))])
+		log, dynamicLog = nil, nil
+		sm.Dispatch(event)
+		dynamic.Dispatch(event)
+		assert.Equal(t, log, dynamicLog, EventName(event.Type()))
+		assert.Equal(t, sm.GetState().ID(), dynamic.GetState().ID())
+	}
+}
@@ -0,0 +1,100 @@
+package hsmtest
+
+import (
+	"sort"
+	"time"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// FakeClock is an hsm.Clock whose time passes only by Advance(), so that
+// the time events of state machines are dispatched deterministically
+// on the goroutine of the test.
+type FakeClock struct {
+	now    time.Time
+	timers []*fakeTimer
+	// The sequence number of the next timer, to fire the timers
+	// with the same deadline in the order of scheduling
+	seq uint64
+}
+
+// NewFakeClock() creates a fake clock starting at start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now() is part of interface hsm.Clock.
+func (self *FakeClock) Now() time.Time {
+	return self.now
+}
+
+// AfterFunc() is part of interface hsm.Clock. f is called by Advance()
+// when the clock reaches the deadline.
+func (self *FakeClock) AfterFunc(d time.Duration, f func()) hsm.Timer {
+	timer := &fakeTimer{
+		clock:    self,
+		deadline: self.now.Add(d),
+		seq:      self.seq,
+		f:        f,
+	}
+	self.seq++
+	self.timers = append(self.timers, timer)
+	return timer
+}
+
+// Advance() moves the clock forward by d, and calls all the functions
+// scheduled before the new time in the order of their deadlines. The time
+// is set to the deadline of each function when it's called, and the
+// functions scheduled by them are called as well if they are due.
+func (self *FakeClock) Advance(d time.Duration) {
+	end := self.now.Add(d)
+	for {
+		timer := self.next()
+		if timer == nil || timer.deadline.After(end) {
+			break
+		}
+		timer.Stop()
+		self.now = timer.deadline
+		timer.f()
+	}
+	self.now = end
+}
+
+// Pending() returns the number of functions scheduled but not called yet.
+func (self *FakeClock) Pending() int {
+	return len(self.timers)
+}
+
+// next() returns the earliest pending timer, nil if there is none.
+func (self *FakeClock) next() *fakeTimer {
+	if len(self.timers) == 0 {
+		return nil
+	}
+	sort.SliceStable(self.timers, func(i, j int) bool {
+		a, b := self.timers[i], self.timers[j]
+		if a.deadline.Equal(b.deadline) {
+			return a.seq < b.seq
+		}
+		return a.deadline.Before(b.deadline)
+	})
+	return self.timers[0]
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	seq      uint64
+	f        func()
+}
+
+// Stop() is part of interface hsm.Timer.
+func (self *fakeTimer) Stop() bool {
+	timers := self.clock.timers
+	for i, timer := range timers {
+		if timer == self {
+			self.clock.timers = append(timers[:i], timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
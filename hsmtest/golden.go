@@ -0,0 +1,130 @@
+package hsmtest
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/stretchr/testify/assert"
+)
+
+// Update makes Golden() regenerate the golden files instead of comparing
+// with them. It's also turned on by the boolean flag named UpdateFlag if
+// the test binary defines one, e.g.
+//
+//	var update = flag.Bool("update", false, "regenerate the golden files")
+//
+// hsmtest doesn't define the flag itself, so that it never clashes with
+// the flags of the test binary.
+var Update = false
+
+// UpdateFlag is the name of the flag looked up by Golden(), see Update.
+var UpdateFlag = "update"
+
+// updating() tests whether the golden files are regenerated.
+func updating() bool {
+	if Update {
+		return true
+	}
+	f := flag.Lookup(UpdateFlag)
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	value, ok := getter.Get().(bool)
+	return ok && value
+}
+
+// Golden() dispatches the events listed in the file at path, one name
+// per line, to sm, and compares the full trace with the file of the same
+// name but extension ".golden". Blank lines and lines starting with '#'
+// in the events file are skipped. sm is initialized first if it's not.
+// With Update on, e.g. by flag -update, the golden file is regenerated
+// instead, so that the changes of behaviour are reviewed as its diff.
+//
+// The trace is formatted like "hsmctl simulate", e.g.
+//
+//	event open
+//	  closed-Exit
+//	  opened-Entry
+//	  closed-Handle(open)
+//	state opened
+func Golden(t testing.TB, sm Machine, path string) bool {
+	t.Helper()
+	trace, err := goldenTrace(sm, path)
+	if err != nil {
+		t.Fatalf("%s: %v", path, err)
+		return false
+	}
+	golden := strings.TrimSuffix(path, filepath.Ext(path)) + ".golden"
+	if updating() {
+		if err := ioutil.WriteFile(golden, trace, 0644); err != nil {
+			t.Fatalf("%v", err)
+			return false
+		}
+		return true
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v, run with -update to generate it", err)
+		return false
+	}
+	return assert.Equal(t, string(expected), string(trace),
+		"trace of %s differs from %s", path, golden)
+}
+
+// goldenTrace() runs the events listed in the file at path, and returns
+// the trace of sm.
+func goldenTrace(sm Machine, path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var buf bytes.Buffer
+	recorder := Attach(sm)
+	defer sm.RemoveObserver(recorder)
+	flush := func() {
+		for _, text := range recorder.Trace() {
+			fmt.Fprintf(&buf, "  %s\n", text)
+		}
+		recorder.Reset()
+		fmt.Fprintf(&buf, "state %s\n", sm.GetState().ID())
+	}
+	if sm.GetState().ID() == hsm.TopStateID {
+		fmt.Fprintf(&buf, "init\n")
+		sm.Init()
+	}
+	flush()
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") {
+			continue
+		}
+		eventType, ok := hsm.LookupEventType(name)
+		if !ok {
+			return nil, fmt.Errorf("line %d: unknown event %q", line, name)
+		}
+		if hsm.IsReservedEventType(eventType) {
+			return nil, fmt.Errorf("line %d: event %q is reserved", line, name)
+		}
+		fmt.Fprintf(&buf, "event %s\n", name)
+		sm.Dispatch(hsm.StdEventOf(eventType))
+		flush()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,92 @@
+package hsmtest
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/stretchr/testify/assert"
+)
+
+func newUninitializedHSM(t *testing.T) *hsm.StdHSM {
+	definition, err := definition.Read(strings.NewReader(testYAML), definition.FormatYAML)
+	assert.Nil(t, err)
+	sm, err := hsm.Build(definition, nil)
+	assert.Nil(t, err)
+	return sm
+}
+
+func TestGolden(t *testing.T) {
+	sm := newUninitializedHSM(t)
+	Golden(t, sm, "testdata/scenario1.events")
+	assert.Equal(t, 0, len(sm.Observers))
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hsmtest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	events := filepath.Join(dir, "scenario.events")
+	assert.Nil(t, ioutil.WriteFile(events, []byte("C\n"), 0644))
+	Update = true
+	defer func() { Update = false }()
+	assert.True(t, Golden(t, newUninitializedHSM(t), events))
+	golden, err := ioutil.ReadFile(filepath.Join(dir, "scenario.golden"))
+	assert.Nil(t, err)
+	assert.Equal(t, `init
+  Initial-Init
+  s0-Entry
+  s0-Init
+  s1-Entry
+  s1-Init
+  s11-Entry
+state s11
+event C
+  s11-Exit
+  s1-Exit
+  s2-Entry
+  s2-Init
+  s21-Entry
+  s21-Init
+  s211-Entry
+  s1-Handle(C)
+state s211
+`, string(golden))
+}
+
+func TestGoldenTraceError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hsmtest")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	events := filepath.Join(dir, "scenario.events")
+	assert.Nil(t, ioutil.WriteFile(events, []byte("C\n\nno-such-event\n"), 0644))
+	_, err = goldenTrace(newUninitializedHSM(t), events)
+	assert.EqualError(t, err, `line 3: unknown event "no-such-event"`)
+	assert.Nil(t, ioutil.WriteFile(events, []byte("C\nEntry\n"), 0644))
+	_, err = goldenTrace(newUninitializedHSM(t), events)
+	assert.EqualError(t, err, `line 2: event "Entry" is reserved`)
+	_, err = goldenTrace(newUninitializedHSM(t), filepath.Join(dir, "none"))
+	assert.NotNil(t, err)
+}
+
+// update is the flag of this test binary, which would panic as redefined
+// if hsmtest defined it as well.
+var update = flag.Bool("update", false, "regenerate the golden files")
+
+func TestUpdateFlag(t *testing.T) {
+	original := *update
+	defer func() { *update = original }()
+	*update = false
+	assert.False(t, updating())
+	assert.Nil(t, flag.Set("update", "true"))
+	assert.True(t, updating())
+	// the flag of another name is not looked up
+	UpdateFlag = "regenerate"
+	defer func() { UpdateFlag = "update" }()
+	assert.False(t, updating())
+}
@@ -0,0 +1,154 @@
+// Package hsmtest helps to test state machines by scenarios. It records
+// every callback of a state machine through an observer, and checks the
+// order of the exit, entry and init actions of each dispatching, e.g.
+// a transition from s11 to s2, which is initialized down to s211:
+//
+//	hsmtest.ExpectTrace(t, sm, hsm.StdEventOf(EventC),
+//		"s11-Exit", "s1-Exit", "s2-Entry", "s2-Init", "s21-Entry",
+//		"s21-Init", "s211-Entry")
+//	hsmtest.ExpectState(t, sm, "s211")
+//	hsmtest.ExpectUnhandled(t, sm, hsm.StdEventOf(EventA))
+package hsmtest
+
+import (
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/stretchr/testify/assert"
+)
+
+// Machine is a state machine which could be observed, like hsm.StdHSM
+// and every HSM which embeds it.
+type Machine interface {
+	hsm.HSM
+	AddObserver(observer hsm.Observer)
+	RemoveObserver(observer hsm.Observer)
+}
+
+// Recorder is an observer which records every callback of state machine.
+type Recorder struct {
+	Records []*Record
+}
+
+// Record is a TraceRecord retained by Recorder.
+type Record struct {
+	Kind    hsm.TraceKind
+	StateID string
+	Event   hsm.Event
+	Message string
+	// The record formatted like "s21-Exit", see hsm.TraceRecord
+	Text string
+}
+
+// NewRecorder() creates a recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Attach() creates a recorder and registers it to sm.
+func Attach(sm Machine) *Recorder {
+	recorder := NewRecorder()
+	sm.AddObserver(recorder)
+	return recorder
+}
+
+// Observe() is part of interface hsm.Observer.
+func (self *Recorder) Observe(record *hsm.TraceRecord) {
+	self.Records = append(self.Records, &Record{
+		Kind:    record.Kind,
+		StateID: record.StateID,
+		Event:   record.Event,
+		Message: record.Message,
+		Text:    record.String(),
+	})
+}
+
+// Reset() drops all the records.
+func (self *Recorder) Reset() {
+	self.Records = nil
+}
+
+// Trace() returns all the records formatted, e.g. "s1-Handle(C)" for
+// Handle and "Warning: ..." for warning.
+func (self *Recorder) Trace() []string {
+	trace := make([]string, 0, len(self.Records))
+	for _, record := range self.Records {
+		trace = append(trace, record.Text)
+	}
+	return trace
+}
+
+// Chain() returns the records of the exit, entry and init actions
+// formatted, e.g. "s21-Exit".
+func (self *Recorder) Chain() []string {
+	chain := make([]string, 0, len(self.Records))
+	for _, record := range self.Records {
+		switch record.Kind {
+		case hsm.TraceInit, hsm.TraceEntry, hsm.TraceExit:
+			chain = append(chain, record.Text)
+		}
+	}
+	return chain
+}
+
+// Handled() returns the IDs of the states whose Handle() consumed an event.
+func (self *Recorder) Handled() []string {
+	var handled []string
+	for _, record := range self.Records {
+		if record.Kind == hsm.TraceHandle {
+			handled = append(handled, record.StateID)
+		}
+	}
+	return handled
+}
+
+// Capture() records the callbacks of sm during f.
+func Capture(sm Machine, f func()) *Recorder {
+	recorder := Attach(sm)
+	defer sm.RemoveObserver(recorder)
+	f()
+	return recorder
+}
+
+// ExpectTrace() dispatches event to sm, and checks the exit, entry and init
+// actions run in order, like "s21-Exit", "s2-Exit", "s1-Entry".
+func ExpectTrace(t testing.TB, sm Machine, event hsm.Event,
+	chain ...string) bool {
+
+	t.Helper()
+	return ExpectTraceFunc(t, sm, func() {
+		sm.Dispatch(event)
+	}, chain...)
+}
+
+// ExpectTraceFunc() is like ExpectTrace(), but checks the actions run
+// during f, e.g. when a fake clock advances.
+func ExpectTraceFunc(t testing.TB, sm Machine, f func(),
+	chain ...string) bool {
+
+	t.Helper()
+	if chain == nil {
+		chain = []string{}
+	}
+	return assert.Equal(t, chain, Capture(sm, f).Chain())
+}
+
+// ExpectState() checks the current state of sm is stateID.
+func ExpectState(t testing.TB, sm hsm.HSM, stateID string) bool {
+	t.Helper()
+	return assert.Equal(t, stateID, sm.GetState().ID())
+}
+
+// ExpectUnhandled() dispatches event to sm, and checks it's handled by
+// none of the states, with no transition taken.
+func ExpectUnhandled(t testing.TB, sm Machine, event hsm.Event) bool {
+	t.Helper()
+	stateID := sm.GetState().ID()
+	recorder := Capture(sm, func() {
+		sm.Dispatch(event)
+	})
+	return assert.Empty(t, recorder.Handled(),
+		"event %s", hsm.EventName(event.Type())) &&
+		assert.Equal(t, []string{}, recorder.Chain()) &&
+		assert.Equal(t, stateID, sm.GetState().ID())
+}
@@ -0,0 +1,151 @@
+package hsmtest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAML = `
+name: annotated
+initial: s0
+states:
+  - id: s0
+    transitions:
+      - {event: E, target: s211}
+    states:
+      - id: s1
+        transitions:
+          - {event: C, target: s2}
+          - {event: D, target: s0}
+        states:
+          - id: s11
+      - id: s2
+        transitions:
+          - {event: C, target: s1}
+        states:
+          - id: s21
+            states:
+              - id: s211
+                transitions:
+                  - {event: D, target: s21}
+`
+
+func newTestHSM(t *testing.T, doc string, bindings *hsm.Bindings) *hsm.StdHSM {
+	definition, err := definition.Read(strings.NewReader(doc), definition.FormatYAML)
+	assert.Nil(t, err)
+	sm, err := hsm.Build(definition, bindings)
+	assert.Nil(t, err)
+	sm.Init()
+	return sm
+}
+
+func event(name string) hsm.Event {
+	return hsm.StdEventOf(hsm.InternEventType(name))
+}
+
+func TestExpect(t *testing.T) {
+	sm := newTestHSM(t, testYAML, nil)
+	ExpectState(t, sm, "s11")
+	ExpectTrace(t, sm, event("C"),
+		"s11-Exit", "s1-Exit", "s2-Entry", "s2-Init", "s21-Entry",
+		"s21-Init", "s211-Entry")
+	ExpectState(t, sm, "s211")
+	ExpectTrace(t, sm, event("D"), "s211-Exit", "s21-Init", "s211-Entry")
+	ExpectUnhandled(t, sm, event("A"))
+	// the recorders are removed after checking
+	assert.Equal(t, 0, len(sm.Observers))
+
+	mock := &testing.T{}
+	assert.False(t, ExpectUnhandled(mock, sm, event("C")))
+	assert.False(t, ExpectTrace(mock, sm, event("C"), "s211-Exit"))
+	assert.False(t, ExpectState(mock, sm, "s11"))
+}
+
+func TestRecorder(t *testing.T) {
+	sm := newTestHSM(t, testYAML, nil)
+	recorder := Attach(sm)
+	sm.Dispatch(event("E"))
+	assert.Equal(t, []string{
+		"s11-Exit", "s1-Exit", "s2-Entry", "s21-Entry", "s211-Entry",
+		"s0-Handle(E)"}, recorder.Trace())
+	assert.Equal(t, []string{"s0"}, recorder.Handled())
+	assert.Equal(t, 5, len(recorder.Chain()))
+	recorder.Reset()
+	assert.Equal(t, []string{}, recorder.Trace())
+	// the top state dropping an unhandled event is not traced
+	sm.Dispatch(event("A"))
+	assert.Equal(t, []string{}, recorder.Trace())
+	assert.Nil(t, recorder.Handled())
+}
+
+const testTimeoutYAML = `
+name: door
+states:
+  - id: closed
+    transitions:
+      - {event: open, target: opened}
+  - id: opened
+    entry: [armTimer]
+    exit: [stopTimer]
+    transitions:
+      - {event: close, target: closed}
+      - {event: timeout, target: closed}
+`
+
+func TestFakeClock(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var timer hsm.Timer
+	bindings := hsm.NewBindings().
+		BindAction("armTimer", func(sm hsm.HSM, e hsm.Event) {
+			timer = clock.AfterFunc(5*time.Second, func() {
+				sm.Dispatch(event("timeout"))
+			})
+		}).
+		BindAction("stopTimer", func(sm hsm.HSM, e hsm.Event) {
+			timer.Stop()
+		})
+	sm := newTestHSM(t, testTimeoutYAML, bindings)
+	ExpectTrace(t, sm, event("open"), "closed-Exit", "opened-Entry")
+	assert.Equal(t, 1, clock.Pending())
+	ExpectTraceFunc(t, sm, func() { clock.Advance(4 * time.Second) })
+	ExpectState(t, sm, "opened")
+	ExpectTraceFunc(t, sm, func() {
+		clock.Advance(time.Second)
+	}, "opened-Exit", "closed-Entry")
+	assert.Equal(t, time.Unix(5, 0), clock.Now())
+	assert.Equal(t, 0, clock.Pending())
+	// the timer is stopped on close
+	sm.Dispatch(event("open"))
+	sm.Dispatch(event("close"))
+	assert.Equal(t, 0, clock.Pending())
+	ExpectTraceFunc(t, sm, func() { clock.Advance(time.Minute) })
+}
+
+func TestFakeClockOrder(t *testing.T) {
+	clock := NewFakeClock(time.Unix(0, 0))
+	var fired []int
+	clock.AfterFunc(2*time.Second, func() {
+		fired = append(fired, 2)
+	})
+	clock.AfterFunc(time.Second, func() {
+		fired = append(fired, 1)
+		// due within the same advance
+		clock.AfterFunc(time.Second, func() {
+			assert.Equal(t, time.Unix(2, 0), clock.Now())
+			fired = append(fired, 3)
+		})
+	})
+	stopped := clock.AfterFunc(time.Second, func() {
+		fired = append(fired, 0)
+	})
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	clock.Advance(3 * time.Second)
+	assert.Equal(t, []int{1, 2, 3}, fired)
+	assert.Equal(t, time.Unix(3, 0), clock.Now())
+}
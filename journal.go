@@ -0,0 +1,192 @@
+package hsm
+
+import (
+	"fmt"
+)
+
+// EventRecord is an event persisted in EventStore.
+type EventRecord struct {
+	// The sequence number of this event in the log, started from 1
+	Seq uint64 `json:"seq"`
+	// The registered name of event type
+	Type string `json:"type"`
+	// The payload encoded by EventCodec, empty if there is none
+	Data []byte `json:"data,omitempty"`
+}
+
+// EventCodec converts events to records to be persisted and back.
+type EventCodec interface {
+	// Sets the type and data of record for event. Seq is set by Journal.
+	EncodeEvent(event Event) (*EventRecord, error)
+	DecodeEvent(record *EventRecord) (Event, error)
+}
+
+type stdEventCodec struct{}
+
+func (stdEventCodec) EncodeEvent(event Event) (*EventRecord, error) {
+	name := EventName(event.Type())
+	if t, ok := LookupEventType(name); !ok || t != event.Type() {
+		return nil, fmt.Errorf("event type %d is not registered", event.Type())
+	}
+	return &EventRecord{Type: name}, nil
+}
+
+func (stdEventCodec) DecodeEvent(record *EventRecord) (Event, error) {
+	t, ok := LookupEventType(record.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown event %q at %d", record.Type, record.Seq)
+	}
+	return NewStdEvent(t), nil
+}
+
+// StdEventCodec persists events by their registered type names only,
+// and decodes them into StdEvent. Events carrying payload need their
+// own EventCodec.
+var StdEventCodec EventCodec = stdEventCodec{}
+
+// EventStore is an append-only log of events, compacted by snapshots.
+type EventStore interface {
+	// Appends record to the log. It's durable when returned.
+	Append(record *EventRecord) error
+	// Returns the latest snapshot saved, nil if there is none, and all
+	// the records appended after it in order.
+	Load() (*Snapshot, []*EventRecord, error)
+	// Saves snapshot and drops the records up to snapshot.Seq.
+	Compact(snapshot *Snapshot) error
+	Close() error
+}
+
+// Persistent is the state machine which could be journaled.
+// Every HSM which embeds StdHSM implements it as long as its Snapshot()
+// and Restore() save its extended state, see Snapshot2() and Restore2().
+type Persistent interface {
+	HSM
+	Snapshot(codec Codec) (*Snapshot, error)
+	Restore(snapshot *Snapshot, codec Codec) error
+	setReplaying(replaying bool)
+}
+
+// IsReplaying() tests whether the event being handled by hsm is replayed
+// from a journal on recovery. Actions with side effects outside
+// the state machine, like I/O, should be skipped when it's true,
+// since they were done when the event was dispatched at first.
+func IsReplaying(hsm HSM) bool {
+	if r, ok := hsm.(replayable); ok {
+		return r.isReplaying()
+	}
+	return false
+}
+
+// replayable is implemented by StdHSM, and so by every HSM which
+// embeds StdHSM, for IsReplaying().
+type replayable interface {
+	isReplaying() bool
+}
+
+func (self *StdHSM) isReplaying() bool {
+	return self.Replaying
+}
+
+func (self *StdHSM) setReplaying(replaying bool) {
+	self.Replaying = replaying
+}
+
+// Journal persists a state machine by event sourcing. Every event is
+// appended to Store before it's dispatched, and the state machine is
+// recovered by replaying the events logged.
+type Journal struct {
+	Store EventStore
+	// The codec of events
+	Events EventCodec
+	// The codec of extended state in snapshots, JSONCodec if nil
+	Data Codec
+	// Compacts the log after so many events appended if positive
+	CompactEvery int
+	// The sequence number of the last event appended
+	Seq uint64
+	// The number of events appended since the last compaction
+	Appended int
+}
+
+// Constructor for Journal.
+func NewJournal(store EventStore, events EventCodec, data Codec) *Journal {
+	return &Journal{
+		Store:  store,
+		Events: events,
+		Data:   data,
+	}
+}
+
+// Recover() brings a new state machine sm to the state logged. It's called
+// in place of Init(). sm is restored from the latest snapshot if any,
+// or initialized otherwise, and then all the events logged after are
+// replayed. IsReplaying(sm) is true during the whole procedure, except
+// that sm is initialized for the first time with nothing logged.
+func (self *Journal) Recover(sm Persistent) error {
+	snapshot, records, err := self.Store.Load()
+	if err != nil {
+		return err
+	}
+	if snapshot == nil && len(records) == 0 {
+		sm.Init()
+		return nil
+	}
+	sm.setReplaying(true)
+	defer sm.setReplaying(false)
+	if snapshot != nil {
+		if err := sm.Restore(snapshot, self.Data); err != nil {
+			return err
+		}
+		self.Seq = snapshot.Seq
+	} else {
+		sm.Init()
+	}
+	for _, record := range records {
+		if record.Seq != self.Seq+1 {
+			return fmt.Errorf("event %d is logged after %d", record.Seq, self.Seq)
+		}
+		event, err := self.Events.DecodeEvent(record)
+		if err != nil {
+			return err
+		}
+		sm.Dispatch(event)
+		self.Seq = record.Seq
+	}
+	self.Appended = len(records)
+	return nil
+}
+
+// Dispatch() appends event to the log and then dispatches it to sm.
+// The event is not dispatched if it fails to be logged.
+func (self *Journal) Dispatch(sm Persistent, event Event) error {
+	record, err := self.Events.EncodeEvent(event)
+	if err != nil {
+		return err
+	}
+	record.Seq = self.Seq + 1
+	if err := self.Store.Append(record); err != nil {
+		return err
+	}
+	self.Seq = record.Seq
+	self.Appended++
+	sm.Dispatch(event)
+	if self.CompactEvery > 0 && self.Appended >= self.CompactEvery {
+		return self.Compact(sm)
+	}
+	return nil
+}
+
+// Compact() takes the snapshot of sm, and drops the events before it
+// from the log.
+func (self *Journal) Compact(sm Persistent) error {
+	snapshot, err := sm.Snapshot(self.Data)
+	if err != nil {
+		return err
+	}
+	snapshot.Seq = self.Seq
+	if err := self.Store.Compact(snapshot); err != nil {
+		return err
+	}
+	self.Appended = 0
+	return nil
+}
@@ -0,0 +1,149 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newJournaledHSM() builds the door of testJSON, whose actions are logged
+// unless replaying.
+func newJournaledHSM(t *testing.T, log *[]string) *StdHSM {
+	bindings := newTestBindings(log)
+	for name, action := range bindings.Actions {
+		action := action
+		bindings.Actions[name] = func(sm HSM, event Event) {
+			if !IsReplaying(sm) {
+				action(sm, event)
+			}
+		}
+	}
+	sm, err := loadTestDefinition(testJSON, bindings)
+	assert.Nil(t, err)
+	return sm
+}
+
+func openTestJournal(t *testing.T, path string) *Journal {
+	store, err := OpenFileEventStore(path)
+	assert.Nil(t, err)
+	return NewJournal(store, StdEventCodec, nil)
+}
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "door.log")
+	var log []string
+	journal := openTestJournal(t, path)
+	sm := newJournaledHSM(t, &log)
+	assert.Nil(t, journal.Recover(sm))
+	for _, name := range []string{"knock", "open", "close", "open"} {
+		assert.Nil(t, journal.Dispatch(sm, NewStdEvent(InternEventType(name))))
+	}
+	assert.Equal(t, "opened", sm.GetState().ID())
+	assert.Equal(t, []string{"lightOff", "beep", "beep", "lightOff", "beep"}, log)
+	assert.Nil(t, journal.Store.Close())
+
+	// the actions are not run again on recovery
+	log = nil
+	journal = openTestJournal(t, path)
+	sm = newJournaledHSM(t, &log)
+	assert.Nil(t, journal.Recover(sm))
+	assert.Equal(t, "opened", sm.GetState().ID())
+	assert.Equal(t, uint64(4), journal.Seq)
+	assert.Equal(t, 0, len(log))
+	assert.False(t, IsReplaying(sm))
+
+	// compact and append more
+	assert.Nil(t, journal.Compact(sm))
+	assert.Nil(t, journal.Dispatch(sm, NewStdEvent(InternEventType("close"))))
+	assert.Nil(t, journal.Store.Close())
+	snapshot, records, err := openTestJournal(t, path).Store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), snapshot.Seq)
+	assert.Equal(t, []*EventRecord{{Seq: 5, Type: "close"}}, records)
+
+	// a partial record left by crash is dropped
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteString(`{"seq":6,"ty`)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+	journal = openTestJournal(t, path)
+	sm = newJournaledHSM(t, &log)
+	assert.Nil(t, journal.Recover(sm))
+	assert.Equal(t, "closed", sm.GetState().ID())
+	assert.Equal(t, uint64(5), journal.Seq)
+	assert.Nil(t, journal.Dispatch(sm, NewStdEvent(InternEventType("open"))))
+	assert.Nil(t, journal.Store.Close())
+	_, records, err = openTestJournal(t, path).Store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+}
+
+func TestJournalCompactEvery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "door.log")
+	var log []string
+	journal := openTestJournal(t, path)
+	journal.CompactEvery = 2
+	sm := newJournaledHSM(t, &log)
+	assert.Nil(t, journal.Recover(sm))
+	for _, name := range []string{"open", "close", "open"} {
+		assert.Nil(t, journal.Dispatch(sm, NewStdEvent(InternEventType(name))))
+	}
+	snapshot, records, err := journal.Store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), snapshot.Seq)
+	assert.Equal(t, "closed", snapshot.StateID)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, 1, journal.Appended)
+	assert.Nil(t, journal.Store.Close())
+}
+
+func TestJournalCompactHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	newHistoryHSM := func() *StdHSM {
+		sm, err := Build(newHistoryDefinition(), nil)
+		assert.Nil(t, err)
+		return sm
+	}
+	journal := openTestJournal(t, path)
+	sm := newHistoryHSM()
+	assert.Nil(t, journal.Recover(sm))
+	for _, name := range []string{"N", "N", "X"} {
+		assert.Nil(t, journal.Dispatch(sm, NewStdEvent(InternEventType(name))))
+	}
+	assert.Equal(t, "s2", sm.GetState().ID())
+	// no event is left to replay the history recorded
+	assert.Nil(t, journal.Compact(sm))
+	assert.Nil(t, journal.Store.Close())
+	_, records, err := openTestJournal(t, path).Store.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(records))
+
+	for _, c := range []struct {
+		event    string
+		expected string
+	}{
+		{"Y", "b1"},
+		{"Z", "b2"},
+	} {
+		journal = openTestJournal(t, path)
+		sm = newHistoryHSM()
+		assert.Nil(t, journal.Recover(sm))
+		assert.Equal(t, "s2", sm.GetState().ID())
+		sm.Dispatch(NewStdEvent(InternEventType(c.event)))
+		assert.Equal(t, c.expected, sm.GetState().ID())
+		assert.Nil(t, journal.Store.Close())
+	}
+}
+
+func TestJournalUnregisteredEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "door.log")
+	var log []string
+	journal := openTestJournal(t, path)
+	sm := newJournaledHSM(t, &log)
+	assert.Nil(t, journal.Recover(sm))
+	assert.NotNil(t, journal.Dispatch(sm, NewStdEvent(EventUser+999)))
+	assert.Equal(t, uint64(0), journal.Seq)
+	assert.Nil(t, journal.Store.Close())
+}
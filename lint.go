@@ -0,0 +1,85 @@
+package hsm
+
+import "fmt"
+
+// Lint() reports the suspicious constructs in definition which are legal
+// but likely mistakes: states never reachable, transitions shadowed by
+// earlier ones without guard, and final states with transitions.
+// The definition should be valid, see Validate().
+func (self *Definition) Lint() []string {
+	var warnings []string
+	parents := make(map[string]*StateDefinition)
+	states := make(map[string]*StateDefinition)
+	var order []*StateDefinition
+	var collect func(super, state *StateDefinition)
+	collect = func(super, state *StateDefinition) {
+		parents[state.ID] = super
+		states[state.ID] = state
+		order = append(order, state)
+		for _, child := range state.States {
+			collect(state, child)
+		}
+	}
+	for _, state := range self.States {
+		collect(nil, state)
+	}
+
+	reachable := make(map[string]bool)
+	var queue []string
+	var reach func(id string)
+	reach = func(id string) {
+		// entering a state enters all its super states,
+		// and drills into its initial child
+		for s := states[id]; s != nil && !reachable[s.ID]; s = parents[s.ID] {
+			reachable[s.ID] = true
+			queue = append(queue, s.ID)
+		}
+		state := states[id]
+		init := initialOf(state.States, state.Initial)
+		if state.History != "" && init == "" {
+			// a history without default resumes the initial child
+			// of its super state, see History.DefaultStateID
+			if super := parents[id]; super != nil {
+				init = initialOf(super.States, super.Initial)
+			} else {
+				init = initialOf(self.States, self.Initial)
+			}
+		}
+		if init != "" {
+			reach(init)
+		}
+	}
+	reach(initialOf(self.States, self.Initial))
+	for len(queue) != 0 {
+		state := states[queue[0]]
+		queue = queue[1:]
+		for _, tran := range state.Transitions {
+			if tran.Target != "" {
+				reach(tran.Target)
+			}
+		}
+	}
+
+	for _, state := range order {
+		if !reachable[state.ID] {
+			warnings = append(warnings,
+				fmt.Sprintf("state %q is unreachable", state.ID))
+		}
+		if state.Final && len(state.Transitions) != 0 {
+			warnings = append(warnings,
+				fmt.Sprintf("final state %q has transitions", state.ID))
+		}
+		unguarded := make(map[string]bool)
+		for i, tran := range state.Transitions {
+			if unguarded[tran.Event] {
+				warnings = append(warnings, fmt.Sprintf(
+					"transition #%d of state %q on %q is shadowed",
+					i+1, state.ID, tran.Event))
+			}
+			if tran.Guard == "" {
+				unguarded[tran.Event] = true
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,133 @@
+package hsm
+
+import (
+	"fmt"
+)
+
+// Migration rewrites a snapshot taken from definition version From
+// into the version From + 1. The state IDs in the snapshot, including
+// the histories and the states they recorded, are rewritten by Rename
+// and Split, and then Func is called if not nil.
+type Migration struct {
+	// The definition version migrated from
+	From int
+	// The states renamed, from old IDs to new IDs. States are merged by
+	// renaming them to the same ID. A super state removed is renamed
+	// to empty ID, so that it's dropped from the configuration.
+	Rename map[string]string
+	// The states split, from old IDs to the functions choosing the new
+	// state for snapshot, e.g. by its extended state
+	Split map[string]func(snapshot *Snapshot) string
+	// The custom migration, which could rewrite anything in snapshot
+	Func func(snapshot *Snapshot) error
+}
+
+// apply() rewrites snapshot in place, and steps its definition version.
+func (self *Migration) apply(snapshot *Snapshot) error {
+	rewrite := func(id string) string {
+		if split, ok := self.Split[id]; ok {
+			return split(snapshot)
+		}
+		if renamed, ok := self.Rename[id]; ok {
+			return renamed
+		}
+		return id
+	}
+	snapshot.StateID = rewrite(snapshot.StateID)
+	var configuration []string
+	for _, id := range snapshot.Configuration {
+		id = rewrite(id)
+		n := len(configuration)
+		// drop the removed and the merged states
+		if id == "" || (n != 0 && configuration[n-1] == id) {
+			continue
+		}
+		configuration = append(configuration, id)
+	}
+	snapshot.Configuration = configuration
+	if snapshot.History != nil {
+		history := make(map[string]string, len(snapshot.History))
+		for id, last := range snapshot.History {
+			// the history of a removed state is dropped
+			if id, last = rewrite(id), rewrite(last); id != "" && last != "" {
+				history[id] = last
+			}
+		}
+		snapshot.History = history
+	}
+	if self.Func != nil {
+		if err := self.Func(snapshot); err != nil {
+			return err
+		}
+	}
+	snapshot.DefinitionVersion = self.From + 1
+	return nil
+}
+
+// AddMigration() registers the migration from an older definition version
+// to this state machine.
+func (self *StdHSM) AddMigration(migration *Migration) {
+	AssertTrue(migration.From >= 0)
+	AssertTrue(migration.From < self.DefinitionVersion)
+	for _, m := range self.Migrations {
+		AssertNotEqual(migration.From, m.From)
+	}
+	self.Migrations = append(self.Migrations, migration)
+}
+
+// Migrate() returns a copy of snapshot migrated to the definition version
+// of this state machine, by the migrations of all the versions between.
+// The configuration migrated is rebuilt from the ancestors of its state,
+// and the result is checked by CheckSnapshot() so that it is legal.
+// snapshot itself is not changed.
+func (self *StdHSM) Migrate(snapshot *Snapshot) (*Snapshot, error) {
+	if snapshot.DefinitionVersion > self.DefinitionVersion {
+		return nil, fmt.Errorf(
+			"snapshot of definition version %d is newer than %d",
+			snapshot.DefinitionVersion, self.DefinitionVersion)
+	}
+	migrated := *snapshot
+	migrated.Configuration = append([]string(nil), snapshot.Configuration...)
+	migrated.Data = append([]byte(nil), snapshot.Data...)
+	if snapshot.History != nil {
+		migrated.History = make(map[string]string, len(snapshot.History))
+		for id, last := range snapshot.History {
+			migrated.History[id] = last
+		}
+	}
+	for migrated.DefinitionVersion < self.DefinitionVersion {
+		var migration *Migration
+		for _, m := range self.Migrations {
+			if m.From == migrated.DefinitionVersion {
+				migration = m
+			}
+		}
+		if migration == nil {
+			return nil, fmt.Errorf("no migration from definition version %d",
+				migrated.DefinitionVersion)
+		}
+		if err := migration.apply(&migrated); err != nil {
+			return nil, fmt.Errorf(
+				"migrate from definition version %d: %v", migration.From, err)
+		}
+	}
+	// A state renamed into another parent leaves its old ancestors in
+	// the configuration, so it's rebuilt from the leaf state by this
+	// definition, once all the states in it are known.
+	if migrated.DefinitionVersion != snapshot.DefinitionVersion {
+		for _, id := range migrated.Configuration {
+			if _, ok := self.StateTable[id]; !ok {
+				return nil, fmt.Errorf(
+					"unknown state %q in migrated configuration %v",
+					id, migrated.Configuration)
+			}
+		}
+		if state, ok := self.StateTable[migrated.StateID]; ok {
+			migrated.Configuration = configurationOf(state)
+		}
+	}
+	if err := self.CheckSnapshot(&migrated); err != nil {
+		return nil, err
+	}
+	return &migrated, nil
+}
@@ -0,0 +1,205 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testJSONv1 = `
+{
+  "name": "door",
+  "version": 1,
+  "initial": "closed",
+  "states": [
+    {
+      "id": "closed",
+      "states": [
+        {"id": "unlocked"},
+        {"id": "locked"}
+      ]
+    },
+    {"id": "opened"}
+  ]
+}
+`
+
+// The version 2 renames closed to shut, and splits opened into
+// ajar and wide by the extended state.
+const testJSONv2 = `
+{
+  "name": "door",
+  "version": 2,
+  "initial": "shut",
+  "states": [
+    {
+      "id": "shut",
+      "states": [
+        {"id": "unlocked"},
+        {"id": "locked"}
+      ]
+    },
+    {"id": "ajar"},
+    {"id": "wide"}
+  ]
+}
+`
+
+func loadTestVersion(t *testing.T, text string) *StdHSM {
+	sm, err := loadTestDefinition(text, nil)
+	assert.Nil(t, err)
+	return sm
+}
+
+func TestMigrate(t *testing.T) {
+	older := loadTestVersion(t, testJSONv1)
+	older.Init()
+	assert.Equal(t, 1, older.DefinitionVersion)
+	older.QInit("opened")
+	snapshot, err := older.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, snapshot.DefinitionVersion)
+	snapshot.Data = []byte(`{"angle":90}`)
+
+	newer := loadTestVersion(t, testJSONv2)
+	// no migration registered
+	assert.NotNil(t, newer.Restore(snapshot, nil))
+	newer.AddMigration(&Migration{
+		From:   1,
+		Rename: map[string]string{"closed": "shut"},
+		Split: map[string]func(snapshot *Snapshot) string{
+			"opened": func(snapshot *Snapshot) string {
+				if strings.Contains(string(snapshot.Data), "90") {
+					return "wide"
+				}
+				return "ajar"
+			},
+		},
+	})
+	assert.Nil(t, newer.Restore(snapshot, nil))
+	assert.Equal(t, "wide", newer.GetState().ID())
+	// snapshot is not changed by migration
+	assert.Equal(t, "opened", snapshot.StateID)
+
+	older = loadTestVersion(t, testJSONv1)
+	older.Init()
+	older.QInit("locked")
+	snapshot, err = older.Snapshot(nil)
+	assert.Nil(t, err)
+	migrated, err := newer.Migrate(snapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, migrated.DefinitionVersion)
+	assert.Equal(t, "locked", migrated.StateID)
+	assert.Equal(t, []string{"shut", "locked"}, migrated.Configuration)
+
+	// a newer snapshot is never migrated back
+	_, err = loadTestVersion(t, testJSONv1).Migrate(migrated)
+	assert.NotNil(t, err)
+}
+
+func TestMigrateIllegal(t *testing.T) {
+	older := loadTestVersion(t, testJSONv1)
+	older.Init()
+	snapshot, err := older.Snapshot(nil)
+	assert.Nil(t, err)
+	newer := loadTestVersion(t, testJSONv2)
+	// closed is not renamed, so the configuration is illegal
+	newer.AddMigration(&Migration{From: 1})
+	_, err = newer.Migrate(snapshot)
+	assert.NotNil(t, err)
+
+	// merge the children and drop the removed super state
+	newer = loadTestVersion(t, `
+{
+  "name": "door",
+  "version": 2,
+  "states": [{"id": "shut"}, {"id": "opened"}]
+}
+`)
+	newer.AddMigration(&Migration{
+		From: 1,
+		Rename: map[string]string{
+			"closed": "", "unlocked": "shut", "locked": "shut"},
+		Func: func(snapshot *Snapshot) error {
+			snapshot.Data = []byte("{}")
+			return nil
+		},
+	})
+	migrated, err := newer.Migrate(snapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"shut"}, migrated.Configuration)
+	assert.Equal(t, "{}", string(migrated.Data))
+	assert.Nil(t, snapshot.Data)
+}
+
+func TestMigrateAcrossParents(t *testing.T) {
+	older := loadTestVersion(t, testJSONv1)
+	older.Init()
+	older.QInit("locked")
+	snapshot, err := older.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"closed", "locked"}, snapshot.Configuration)
+
+	// locked is renamed to bolted, which is moved into a new parent
+	newer := loadTestVersion(t, `
+{
+  "name": "door",
+  "version": 2,
+  "states": [
+    {"id": "closed", "states": [{"id": "unlocked"}]},
+    {"id": "secured", "states": [{"id": "bolted"}]},
+    {"id": "opened"}
+  ]
+}
+`)
+	newer.AddMigration(&Migration{
+		From:   1,
+		Rename: map[string]string{"locked": "bolted"},
+	})
+	migrated, err := newer.Migrate(snapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, "bolted", migrated.StateID)
+	assert.Equal(t, []string{"secured", "bolted"}, migrated.Configuration)
+	assert.Nil(t, newer.Restore(snapshot, nil))
+	assert.Equal(t, "bolted", newer.GetState().ID())
+	assert.Equal(t, "secured", newer.GetState().Super().ID())
+}
+
+func TestMigrateHistory(t *testing.T) {
+	older, err := Build(newHistoryDefinition(), nil)
+	assert.Nil(t, err)
+	older.Init()
+	older.Dispatch(StdEventOf(InternEventType("N")))
+	older.Dispatch(StdEventOf(InternEventType("X")))
+	snapshot, err := older.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"h": "b", "hd": "b1"}, snapshot.History)
+
+	// the version 1 renames the deep history and b, and splits b1
+	definition := newHistoryDefinition()
+	definition.Version = 1
+	s1 := definition.States[0]
+	s1.States[1].ID = "deep"
+	s1.States[3].ID = "c"
+	s1.States[2].Transitions[0].Target = "c"
+	definition.States[1].Transitions[1].Target = "deep"
+	s1.States[3].States[0].ID = "c1"
+	newer, err := Build(definition, nil)
+	assert.Nil(t, err)
+	newer.AddMigration(&Migration{
+		From:   0,
+		Rename: map[string]string{"hd": "deep", "b": "c"},
+		Split: map[string]func(snapshot *Snapshot) string{
+			"b1": func(snapshot *Snapshot) string { return "c1" },
+		},
+	})
+	migrated, err := newer.Migrate(snapshot)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"h": "c", "deep": "c1"},
+		migrated.History)
+	// the snapshot migrated from is kept
+	assert.Equal(t, map[string]string{"h": "b", "hd": "b1"}, snapshot.History)
+	assert.Nil(t, newer.Restore(snapshot, nil))
+	newer.Dispatch(StdEventOf(InternEventType("Z")))
+	assert.Equal(t, "c1", newer.GetState().ID())
+}
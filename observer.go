@@ -0,0 +1,140 @@
+package hsm
+
+import (
+	"context"
+	"fmt"
+)
+
+type TraceKind uint32
+
+// The kinds of activities traced in state machine.
+const (
+	// The Init() of a state handled the initialization
+	TraceInit TraceKind = iota
+	// The Entry() of a state is executed
+	TraceEntry
+	// The Exit() of a state is executed
+	TraceExit
+	// The Handle() of a state consumed a dispatched event
+	TraceHandle
+	// The engine noticed something suspicious
+	TraceWarning
+)
+
+var traceKindNames = map[TraceKind]string{
+	TraceInit:    "Init",
+	TraceEntry:   "Entry",
+	TraceExit:    "Exit",
+	TraceHandle:  "Handle",
+	TraceWarning: "Warning",
+}
+
+func (kind TraceKind) String() string {
+	if name, ok := traceKindNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("TraceKind(%d)", uint32(kind))
+}
+
+// TraceRecord describes an activity in state machine. Since Handle() is
+// known to handle the event only after it returns, the record of Handle
+// follows the records of the transition it takes.
+type TraceRecord struct {
+	Kind TraceKind
+	// The context of the event being dispatched, see ContextOf().
+	// It carries the request scoped values like trace IDs.
+	Context context.Context
+	// The state whose callback is called, empty for warning
+	StateID string
+	// The event delivered to the callback
+	Event Event
+	// The description for warning
+	Message string
+}
+
+// String() formats the record as "s21-Exit" for Init, Entry and Exit,
+// "s1-Handle(A)" for Handle, and "Warning: ..." for warning.
+func (self *TraceRecord) String() string {
+	switch self.Kind {
+	case TraceHandle:
+		return fmt.Sprintf("%s-%s(%s)",
+			self.StateID, self.Kind, EventName(self.Event.Type()))
+	case TraceWarning:
+		return fmt.Sprintf("%s: %s", self.Kind, self.Message)
+	}
+	return self.StateID + "-" + self.Kind.String()
+}
+
+// Observer is notified of the activities in state machine.
+// The record passed should not be retained after Observe() returns.
+type Observer interface {
+	Observe(record *TraceRecord)
+}
+
+// ObserverFunc adapts an ordinary function to Observer.
+type ObserverFunc func(record *TraceRecord)
+
+// Observe() is part of interface Observer.
+func (f ObserverFunc) Observe(record *TraceRecord) {
+	f(record)
+}
+
+// observable is implemented by StdHSM, and so by every HSM which
+// embeds StdHSM, to be notified from Trigger() and its variants.
+type observable interface {
+	notify(kind TraceKind, state State, event Event)
+}
+
+// notify() tells the observers of hsm that state handled event.
+func notify(hsm HSM, kind TraceKind, state State, event Event) {
+	if o, ok := hsm.(observable); ok {
+		o.notify(kind, state, event)
+	}
+}
+
+// AddObserver() registers observer to this state machine.
+func (self *StdHSM) AddObserver(observer Observer) {
+	self.Observers = append(self.Observers, observer)
+}
+
+func (self *StdHSM) notify(kind TraceKind, state State, event Event) {
+	if len(self.Observers) == 0 {
+		return
+	}
+	self.observe(&TraceRecord{
+		Kind:    kind,
+		Context: ContextOf(self),
+		StateID: state.ID(),
+		Event:   event,
+	})
+}
+
+// Warn() notifies the observers of a warning.
+func (self *StdHSM) Warn(format string, v ...interface{}) {
+	if len(self.Observers) == 0 {
+		return
+	}
+	self.observe(&TraceRecord{
+		Kind:    TraceWarning,
+		Context: ContextOf(self),
+		Message: fmt.Sprintf(format, v...),
+	})
+}
+
+func (self *StdHSM) observe(record *TraceRecord) {
+	for _, observer := range self.Observers {
+		observer.Observe(record)
+	}
+}
+
+// RemoveObserver() unregisters observer from this state machine.
+// The observers of uncomparable types, like ObserverFunc, could not be
+// removed.
+func (self *StdHSM) RemoveObserver(observer Observer) {
+	for i, o := range self.Observers {
+		if o == observer {
+			self.Observers = append(self.Observers[:i], self.Observers[i+1:]...)
+			return
+		}
+	}
+}
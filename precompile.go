@@ -0,0 +1,74 @@
+package hsm
+
+// Precompile() sets up the static transfer chains of all the declared
+// transitions ahead of time, so that their first occurrences run as fast
+// as the later ones. See PrecompileTransition().
+func (self *StdHSM) Precompile() {
+	for _, tran := range self.Transitions {
+		if tran.Target == "" || tran.Event == EventInit {
+			continue
+		}
+		if _, ok := self.StateTable[tran.Target].(*History); ok {
+			// resolved only when taken
+			continue
+		}
+		self.PrecompileTransition(tran.Source, tran.Target)
+	}
+}
+
+// PrecompileTransition() sets up the static transfer chain from the state
+// sourceID to targetID unless it's set up already. The chain is computed
+// from the state hierarchy alone, without calling any callback of states,
+// as all the states on the path exited and entered. The initial
+// transitions from target are run dynamically after the chain, since they
+// could be known only by calling Init().
+func (self *StdHSM) PrecompileTransition(sourceID, targetID string) {
+	source, ok := self.StateTable[sourceID]
+	AssertTrue(ok)
+	target := self.LookupState(targetID)
+	if self.cachedTran(source, target) != nil {
+		return
+	}
+	chain := &StaticTranChain{
+		Target:      self.indexOf(target),
+		DynamicInit: true,
+	}
+	// the path from target up to top
+	var path []State
+	for s := target; s != nil; s = s.Super() {
+		path = append(path, s)
+	}
+	if source == target {
+		// exit and enter again on transition to self
+		chain.Actions = append(chain.Actions,
+			StaticTranAction{State: chain.Target, Event: EventExit},
+			StaticTranAction{State: chain.Target, Event: EventEntry})
+		self.tranCache.Put(self.indexOf(source), chain.Target, chain)
+		return
+	}
+	// exit up to the LCA, which is the first super state of source
+	// (source included) on the path of target
+	lca := -1
+	for s := source; lca < 0; s = s.Super() {
+		AssertNotNil(s)
+		for i, p := range path {
+			if p == s {
+				lca = i
+			}
+		}
+		if lca < 0 {
+			chain.Actions = append(chain.Actions, StaticTranAction{
+				State: self.indexOf(s),
+				Event: EventExit,
+			})
+		}
+	}
+	// enter down to target
+	for i := lca - 1; i >= 0; i-- {
+		chain.Actions = append(chain.Actions, StaticTranAction{
+			State: self.indexOf(path[i]),
+			Event: EventEntry,
+		})
+	}
+	self.tranCache.Put(self.indexOf(source), chain.Target, chain)
+}
@@ -0,0 +1,57 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPrecompile(t *testing.T) {
+	var log, precompiledLog []string
+	sm := newTestHSM(&log)
+	precompiled := newTestHSM(&precompiledLog)
+	precompiled.Precompile()
+	// no callback is called
+	assert.Equal(t, 0, len(precompiledLog))
+	chain := precompiled.cachedTran(
+		precompiled.StateTable["s1"], precompiled.StateTable["s2"])
+	assert.NotNil(t, chain)
+	assert.True(t, chain.DynamicInit)
+
+	sm.Init()
+	precompiled.Init()
+	events := []EventType{
+		testEventA, testEventB, testEventC, testEventD, testEventE,
+		testEventF, testEventG, testEventH, testEventC, testEventD,
+		testEventB, testEventH, testEventG, testEventF, testEventE,
+		testEventA, testEventC, testEventG, testEventD, testEventF,
+	}
+	for _, event := range events {
+		log, precompiledLog = nil, nil
+		sm.Dispatch(NewStdEvent(event))
+		precompiled.Dispatch(NewStdEvent(event))
+		assert.Equal(t, log, precompiledLog, EventName(event))
+		assert.Equal(t, sm.State.ID(), precompiled.State.ID())
+	}
+}
+
+func TestPrecompileTransition(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.PrecompileTransition("s211", "s0")
+	chain := sm.cachedTran(sm.StateTable["s211"], sm.StateTable["s0"])
+	var steps []string
+	for _, action := range chain.Actions {
+		steps = append(steps,
+			sm.States[action.State].ID()+"-"+EventName(action.Event))
+	}
+	// s0 is the LCA which is not exited
+	assert.Equal(t, []string{"s211-Exit", "s21-Exit", "s2-Exit"}, steps)
+	assert.Equal(t, "s0", sm.States[chain.Target].ID())
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventE))
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventG))
+	assert.Equal(t, []string{
+		"s211-Exit", "s21-Exit", "s2-Exit", "s0-Init", "s1-Entry",
+		"s1-Init", "s11-Entry"}, log)
+}
@@ -0,0 +1,82 @@
+package hsm
+
+import (
+	"runtime/debug"
+)
+
+// PanicInfo describes a panic recovered in dispatching.
+type PanicInfo struct {
+	// The value passed to panic()
+	Value interface{}
+	// The stack trace where the panic is recovered
+	Stack []byte
+	// The state handling the event when it panicked
+	StateID string
+	// The event being dispatched
+	Event Event
+}
+
+// RecoveryPolicy controls the recovery from panics in the callbacks
+// of states during dispatching. The configuration before the event is
+// dispatched is restored, without running any exit or entry action
+// since the ones panicked may be done half way. The events posted by
+// the failed step are dropped. After that, the state machine is usable
+// as if the event was never dispatched.
+type RecoveryPolicy struct {
+	// Called with the panic recovered if not nil
+	Hook func(sm HSM, info *PanicInfo)
+	// The state to transfer to, as a normal transition, if not empty.
+	// Instead of the configuration restored, the transition starts from
+	// the states still entered when it panicked, so that none of the states
+	// exited before the panic is exited again. A panic in this transition
+	// is recovered as well, and leaves the state machine in the states
+	// entered then.
+	ErrorStateID string
+}
+
+// recover() is deferred in dispatching to recover the panics by
+// Recovery. state is the current state and queued is the length of
+// Queue before dispatching.
+func (self *StdHSM) recover(hsm HSM, event Event, state State, queued int) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	info := &PanicInfo{
+		Value: value,
+		Stack: debug.Stack(),
+		Event: event,
+	}
+	if self.SourceState != nil {
+		info.StateID = self.SourceState.ID()
+	}
+	self.Warn("recovered from panic in %s on event %s: %v",
+		info.StateID, EventName(event.Type()), value)
+	self.State = state
+	self.SourceState = state
+	if len(self.Queue) > queued {
+		self.Queue = self.Queue[:queued]
+	}
+	if self.Recovery.Hook != nil {
+		self.Recovery.Hook(hsm, info)
+	}
+	if self.Recovery.ErrorStateID != "" {
+		self.tranError(hsm)
+	}
+}
+
+// tranError() transfers from the states still entered to the error state
+// of Recovery.
+func (self *StdHSM) tranError(hsm HSM) {
+	defer func() {
+		if value := recover(); value != nil {
+			self.Warn("recovered from panic in transition to %s: %v",
+				self.Recovery.ErrorStateID, value)
+			self.State = self.active
+			self.SourceState = self.active
+		}
+	}()
+	self.State = self.active
+	self.SourceState = self.active
+	hsm.QTran(self.Recovery.ErrorStateID)
+}
@@ -0,0 +1,116 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testPanicState panics in Entry.
+type testPanicState struct {
+	*testState
+}
+
+func (self *testPanicState) Entry(sm HSM, event Event) State {
+	panic("entry failed")
+}
+
+// newTestPanicHSM() builds the state machine where s1 transfers to
+// s2 on A, to error on B, and s2 panics on entry.
+func newTestPanicHSM(log *[]string) *StdHSM {
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	newTestState(top, "s1", "", map[EventType]string{
+		testEventA: "s2",
+		testEventB: "error",
+	}, log)
+	s2 := &testPanicState{&testState{
+		StateHead: NewStateHead(top), id: "s2", log: log}}
+	top.AddChild(s2)
+	newTestState(top, "error", "", nil, log)
+	return NewStdHSM(HSMTypeStd, top, initial)
+}
+
+func TestRecoveryRestore(t *testing.T) {
+	var log []string
+	sm := newTestPanicHSM(&log)
+	var recovered *PanicInfo
+	sm.Recovery = &RecoveryPolicy{
+		Hook: func(sm HSM, info *PanicInfo) {
+			recovered = info
+		},
+	}
+	var warnings []string
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceWarning {
+			warnings = append(warnings, record.Message)
+		}
+	}))
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s1", sm.GetState().ID())
+	assert.Equal(t, "entry failed", recovered.Value)
+	assert.Equal(t, "s1", recovered.StateID)
+	assert.Equal(t, testEventA, recovered.Event.Type())
+	assert.NotEqual(t, 0, len(recovered.Stack))
+	assert.Equal(t, []string{
+		"recovered from panic in s1 on event A: entry failed"}, warnings)
+	// still usable afterwards
+	sm.Dispatch(NewStdEvent(testEventB))
+	assert.Equal(t, "error", sm.GetState().ID())
+}
+
+func TestRecoveryErrorState(t *testing.T) {
+	var log []string
+	sm := newTestPanicHSM(&log)
+	sm.Recovery = &RecoveryPolicy{ErrorStateID: "error"}
+	sm.Init()
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "error", sm.GetState().ID())
+	// s1 is exited in the failed transition, and not again
+	assert.Equal(t, []string{"s1-Exit", "error-Entry"}, log)
+	// the chain to error from the states entered is cached as well
+	sm = newTestPanicHSM(&log)
+	sm.Recovery = &RecoveryPolicy{ErrorStateID: "error"}
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventA))
+	log = nil
+	sm.QInit("s1")
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "error", sm.GetState().ID())
+	assert.Equal(t, []string{"s1-Exit", "error-Entry"}, log)
+}
+
+func TestRecoveryErrorStatePanics(t *testing.T) {
+	var log []string
+	sm := newTestPanicHSM(&log)
+	// s2 panics on entry as the error state
+	sm.Recovery = &RecoveryPolicy{ErrorStateID: "s2"}
+	var warnings []string
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceWarning {
+			warnings = append(warnings, record.Message)
+		}
+	}))
+	sm.Init()
+	log = nil
+	assert.NotPanics(t, func() {
+		sm.Dispatch(NewStdEvent(testEventA))
+	})
+	assert.Equal(t, []string{"s1-Exit"}, log)
+	// left in the states entered, none but top
+	assert.Equal(t, TopStateID, sm.GetState().ID())
+	assert.Equal(t, []string{
+		"recovered from panic in s1 on event A: entry failed",
+		"recovered from panic in transition to s2: entry failed",
+	}, warnings)
+}
+
+func TestNoRecovery(t *testing.T) {
+	var log []string
+	sm := newTestPanicHSM(&log)
+	sm.Init()
+	assert.Panics(t, func() {
+		sm.Dispatch(NewStdEvent(testEventA))
+	})
+}
@@ -0,0 +1,267 @@
+// Package repl provides an interactive prompt to drive a state machine
+// by hand, printing the exit/entry/init chain of every event dispatched.
+//
+// The commands supported are:
+//
+//	dispatch EVENT  dispatch the event named EVENT
+//	state           print the current state and its super states
+//	isin STATE      test whether the machine is in STATE
+//	history         list the events dispatched since the last reset
+//	undo            replay from start all the events but the last one
+//	reset           create and initialize the machine again
+//	help            list the commands
+//	quit            leave the prompt
+//
+// Machines written in Go are registered by a small main:
+//
+//	func main() {
+//		repl.Register("annotated", func() repl.Machine {
+//			return annotated.NewUninitializedWorld()
+//		})
+//		repl.Main()
+//	}
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	hsm "github.com/hhkbp2/go-hsm"
+)
+
+// Machine is the state machine driven by REPL. Every HSM which embeds
+// StdHSM implements it.
+type Machine interface {
+	hsm.HSM
+	AddObserver(observer hsm.Observer)
+}
+
+// Factory creates a new uninitialized machine. REPL calls it on start,
+// reset and undo, so it must create a fresh machine every time.
+type Factory func() Machine
+
+// Prompt is written before reading every command.
+const Prompt = "hsm> "
+
+// REPL drives a machine by the commands read.
+type REPL struct {
+	factory Factory
+	out     io.Writer
+	machine Machine
+	// the names of events dispatched since the last reset
+	history []string
+	// whether to suppress the trace, used when replaying
+	quiet bool
+}
+
+// New() creates a REPL which prints to out, and initializes the machine
+// created by factory.
+func New(factory Factory, out io.Writer) *REPL {
+	object := &REPL{
+		factory: factory,
+		out:     out,
+	}
+	object.reset(false)
+	return object
+}
+
+// Run() executes the commands read from in until quit or EOF.
+func (self *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(self.out, Prompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(self.out)
+			return scanner.Err()
+		}
+		quit, err := self.Exec(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(self.out, "error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Exec() executes a single command line. It returns true on quit.
+func (self *REPL) Exec(line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	args := fields[1:]
+	expect := func(n int) error {
+		if len(args) != n {
+			return fmt.Errorf("%s expects %d argument(s), see help",
+				fields[0], n)
+		}
+		return nil
+	}
+	switch fields[0] {
+	case "dispatch", "d":
+		if err := expect(1); err != nil {
+			return false, err
+		}
+		return false, self.dispatch(args[0])
+	case "state", "s":
+		if err := expect(0); err != nil {
+			return false, err
+		}
+		self.printState()
+	case "isin":
+		if err := expect(1); err != nil {
+			return false, err
+		}
+		fmt.Fprintln(self.out, self.machine.IsIn(args[0]))
+	case "history", "h":
+		if err := expect(0); err != nil {
+			return false, err
+		}
+		for i, name := range self.history {
+			fmt.Fprintf(self.out, "%3d  %s\n", i+1, name)
+		}
+	case "undo", "u":
+		if err := expect(0); err != nil {
+			return false, err
+		}
+		return false, self.undo()
+	case "reset":
+		if err := expect(0); err != nil {
+			return false, err
+		}
+		self.reset(false)
+	case "help", "?":
+		fmt.Fprint(self.out, help)
+	case "quit", "exit", "q":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown command %q, see help", fields[0])
+	}
+	return false, nil
+}
+
+const help = `dispatch EVENT  dispatch the event named EVENT (alias d)
+state           print the current state and its super states (alias s)
+isin STATE      test whether the machine is in STATE
+history         list the events dispatched since the last reset (alias h)
+undo            replay from start all the events but the last one (alias u)
+reset           create and initialize the machine again
+help            list the commands (alias ?)
+quit            leave the prompt (alias q, exit)
+`
+
+// Observe() prints the trace of machine, it's part of interface Observer.
+func (self *REPL) Observe(record *hsm.TraceRecord) {
+	if !self.quiet {
+		fmt.Fprintf(self.out, "  %s\n", record)
+	}
+}
+
+func (self *REPL) dispatch(name string) error {
+	eventType, ok := hsm.LookupEventType(name)
+	if !ok {
+		return fmt.Errorf("unknown event %q", name)
+	}
+	if hsm.IsReservedEventType(eventType) {
+		return fmt.Errorf("event %q is reserved", name)
+	}
+	self.machine.Dispatch(hsm.NewStdEvent(eventType))
+	self.history = append(self.history, name)
+	if !self.quiet {
+		self.printState()
+	}
+	return nil
+}
+
+// reset() creates and initializes a new machine.
+func (self *REPL) reset(quiet bool) {
+	self.quiet = quiet
+	defer func() {
+		self.quiet = false
+	}()
+	self.machine = self.factory()
+	self.machine.AddObserver(self)
+	self.history = nil
+	self.machine.Init()
+	if !quiet {
+		self.printState()
+	}
+}
+
+// undo() replays all the events in history but the last one
+// on a new machine, without printing the trace.
+func (self *REPL) undo() error {
+	if len(self.history) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+	history := self.history[:len(self.history)-1]
+	self.reset(true)
+	self.quiet = true
+	defer func() {
+		self.quiet = false
+	}()
+	for _, name := range history {
+		if err := self.dispatch(name); err != nil {
+			return err
+		}
+	}
+	self.quiet = false
+	self.printState()
+	return nil
+}
+
+// printState() prints the current state and all its super states.
+func (self *REPL) printState() {
+	var path []string
+	for s := self.machine.GetState(); s != nil; s = s.Super() {
+		path = append(path, s.ID())
+	}
+	fmt.Fprintf(self.out, "state %s\n", strings.Join(path, " < "))
+}
+
+var factories = make(map[string]Factory)
+
+// Register() makes the machine created by factory available to Main()
+// by name.
+func Register(name string, factory Factory) {
+	_, ok := factories[name]
+	hsm.AssertFalse(ok)
+	factories[name] = factory
+}
+
+// Main() runs the prompt on standard input and output, for the machine
+// registered with the name given as the only command line argument.
+// The argument could be omitted if only one machine is registered.
+func Main() {
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var name string
+	switch {
+	case len(os.Args) == 2:
+		name = os.Args[1]
+	case len(os.Args) == 1 && len(names) == 1:
+		name = names[0]
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s machine\nmachines: %s\n",
+			os.Args[0], strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	factory, ok := factories[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown machine %q, machines: %s\n",
+			name, strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	if err := New(factory, os.Stdout).Run(os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,131 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	hsm "github.com/hhkbp2/go-hsm"
+	"github.com/hhkbp2/go-hsm/definition"
+	"github.com/hhkbp2/go-hsm/example/annotated"
+	"github.com/stretchr/testify/assert"
+)
+
+const testYAML = `
+name: door
+initial: closed
+states:
+  - id: closed
+    initial: unlocked
+    states:
+      - id: unlocked
+        transitions:
+          - event: lock
+            target: locked
+      - id: locked
+        transitions:
+          - event: unlock
+            target: unlocked
+    transitions:
+      - event: open
+        target: opened
+  - id: opened
+    transitions:
+      - event: close
+        target: closed
+`
+
+func newTestFactory(t *testing.T) Factory {
+	definition, err := definition.Read(strings.NewReader(testYAML), definition.FormatYAML)
+	assert.Nil(t, err)
+	return func() Machine {
+		sm, err := hsm.Build(definition, nil)
+		assert.Nil(t, err)
+		return sm
+	}
+}
+
+func TestREPL(t *testing.T) {
+	var out bytes.Buffer
+	r := New(newTestFactory(t), &out)
+	input := strings.Join([]string{
+		"dispatch lock",
+		"isin closed",
+		"isin opened",
+		"d open",
+		"history",
+		"undo",
+		"state",
+		"dispatch nothing",
+		"quit",
+		"state",
+	}, "\n")
+	assert.Nil(t, r.Run(strings.NewReader(input)))
+	expected := `  Initial-Init
+  closed-Entry
+  closed-Init
+  unlocked-Entry
+state unlocked < closed < TOP
+hsm>   unlocked-Exit
+  locked-Entry
+  unlocked-Handle(lock)
+state locked < closed < TOP
+hsm> true
+hsm> false
+hsm>   locked-Exit
+  closed-Exit
+  opened-Entry
+  closed-Handle(open)
+state opened < TOP
+hsm>   1  lock
+  2  open
+hsm> state locked < closed < TOP
+hsm> state locked < closed < TOP
+hsm> error: unknown event "nothing"
+hsm> `
+	assert.Equal(t, expected, out.String())
+}
+
+func TestREPLReset(t *testing.T) {
+	var out bytes.Buffer
+	r := New(newTestFactory(t), &out)
+	for _, line := range []string{"dispatch open", "reset"} {
+		quit, err := r.Exec(line)
+		assert.False(t, quit)
+		assert.Nil(t, err)
+	}
+	assert.True(t, r.machine.IsIn("unlocked"))
+	assert.Equal(t, 0, len(r.history))
+	_, err := r.Exec("undo")
+	assert.NotNil(t, err)
+	_, err = r.Exec("isin")
+	assert.NotNil(t, err)
+	// the built-in events are refused
+	for _, name := range []string{"Exit", "Entry", "Init", "Error"} {
+		_, err = r.Exec("dispatch " + name)
+		assert.EqualError(t, err, `event "`+name+`" is reserved`)
+	}
+	assert.True(t, r.machine.IsIn("unlocked"))
+	_, err = r.Exec("jump")
+	assert.NotNil(t, err)
+	quit, err := r.Exec("q")
+	assert.True(t, quit)
+	assert.Nil(t, err)
+}
+
+func TestREPLAnnotated(t *testing.T) {
+	var out bytes.Buffer
+	r := New(func() Machine {
+		return annotated.NewUninitializedWorld()
+	}, &out)
+	for _, line := range []string{"dispatch C", "dispatch E", "undo"} {
+		_, err := r.Exec(line)
+		assert.Nil(t, err, line)
+	}
+	assert.Equal(t, annotated.StateS211ID, r.machine.GetState().ID())
+	assert.Equal(t, []string{"C"}, r.history)
+	_, err := r.Exec("reset")
+	assert.Nil(t, err)
+	assert.Equal(t, annotated.StateS11ID, r.machine.GetState().ID())
+	assert.Equal(t, 0, len(r.history))
+}
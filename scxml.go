@@ -0,0 +1,223 @@
+package hsm
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SCXMLNamespace is the XML namespace of SCXML documents.
+const SCXMLNamespace = "http://www.w3.org/2005/07/scxml"
+
+// The SCXML elements supported. Executable content is limited to
+// <script> elements, whose text is the name of an action in Bindings.
+// The cond attribute of <transition> is the name of a guard in Bindings.
+type scxmlDocument struct {
+	XMLName xml.Name      `xml:"scxml"`
+	XMLNS   string        `xml:"xmlns,attr,omitempty"`
+	Version string        `xml:"version,attr,omitempty"`
+	Name    string        `xml:"name,attr,omitempty"`
+	Initial string        `xml:"initial,attr,omitempty"`
+	States  []*scxmlState `xml:",any"`
+}
+
+type scxmlState struct {
+	XMLName     xml.Name           `xml:""`
+	ID          string             `xml:"id,attr"`
+	Initial     string             `xml:"initial,attr,omitempty"`
+	Type        string             `xml:"type,attr,omitempty"`
+	InitialElem *scxmlInitial      `xml:"initial,omitempty"`
+	OnEntry     []*scxmlExecutable `xml:"onentry,omitempty"`
+	OnExit      []*scxmlExecutable `xml:"onexit,omitempty"`
+	Transitions []*scxmlTransition `xml:"transition,omitempty"`
+	States      []*scxmlState      `xml:",any"`
+}
+
+type scxmlInitial struct {
+	Transition *scxmlTransition `xml:"transition"`
+}
+
+type scxmlExecutable struct {
+	Scripts []string `xml:"script"`
+}
+
+type scxmlTransition struct {
+	Event   string   `xml:"event,attr,omitempty"`
+	Target  string   `xml:"target,attr,omitempty"`
+	Cond    string   `xml:"cond,attr,omitempty"`
+	Scripts []string `xml:"script,omitempty"`
+}
+
+// LoadSCXML() builds a state machine from the SCXML document read from r.
+// The <state>, <final> and <history> elements are supported, <parallel>
+// is not. Actions in <onentry>, <onexit> and <transition> are
+// written as <script> elements whose text is the name of action,
+// and cond attributes of <transition> are names of guards. Both are
+// resolved in bindings. The returned state machine is not initialized.
+func LoadSCXML(r io.Reader, bindings *Bindings) (*StdHSM, error) {
+	definition, err := ReadSCXML(r)
+	if err != nil {
+		return nil, err
+	}
+	return Build(definition, bindings)
+}
+
+// ReadSCXML() reads the SCXML document from r as Definition.
+func ReadSCXML(r io.Reader) (*Definition, error) {
+	var doc scxmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	definition := &Definition{
+		Name:    doc.Name,
+		Initial: doc.Initial,
+	}
+	for _, state := range doc.States {
+		def, err := state.definition()
+		if err != nil {
+			return nil, err
+		}
+		if def != nil {
+			definition.States = append(definition.States, def)
+		}
+	}
+	return definition, nil
+}
+
+// definition() converts the SCXML element to StateDefinition.
+// It returns nil for the elements which are not states.
+func (self *scxmlState) definition() (*StateDefinition, error) {
+	def := &StateDefinition{
+		ID:      self.ID,
+		Initial: self.Initial,
+	}
+	switch self.XMLName.Local {
+	case "state":
+	case "final":
+		def.Final = true
+	case "history":
+		def.History = HistoryShallow
+		if self.Type != "" {
+			def.History = self.Type
+		}
+		// the transition of history goes to its default state
+		if len(self.Transitions) != 0 {
+			def.Initial = self.Transitions[0].Target
+		}
+		return def, nil
+	case "parallel":
+		return nil, fmt.Errorf("unsupported SCXML element <%s> %q",
+			self.XMLName.Local, self.ID)
+	default:
+		// <datamodel>, <script> and others are not states
+		return nil, nil
+	}
+	if self.InitialElem != nil && self.InitialElem.Transition != nil {
+		def.Initial = self.InitialElem.Transition.Target
+	}
+	for _, onentry := range self.OnEntry {
+		def.Entry = append(def.Entry, trimScripts(onentry.Scripts)...)
+	}
+	for _, onexit := range self.OnExit {
+		def.Exit = append(def.Exit, trimScripts(onexit.Scripts)...)
+	}
+	for _, tran := range self.Transitions {
+		if strings.Contains(strings.TrimSpace(tran.Event), " ") ||
+			strings.Contains(tran.Target, " ") {
+			return nil, fmt.Errorf(
+				"multiple events or targets in transition of %q", self.ID)
+		}
+		def.Transitions = append(def.Transitions, &TransitionDefinition{
+			Event:   strings.TrimSpace(tran.Event),
+			Target:  tran.Target,
+			Guard:   tran.Cond,
+			Actions: trimScripts(tran.Scripts),
+		})
+	}
+	for _, child := range self.States {
+		state, err := child.definition()
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			def.States = append(def.States, state)
+		}
+	}
+	return def, nil
+}
+
+func trimScripts(scripts []string) []string {
+	var names []string
+	for _, script := range scripts {
+		names = append(names, strings.TrimSpace(script))
+	}
+	return names
+}
+
+// ExportSCXML() writes the structure of state machine sm to w as
+// SCXML document. See LoadSCXML() for how actions and guards are written.
+func ExportSCXML(sm *StdHSM, w io.Writer) error {
+	return WriteSCXML(DefinitionOf(sm), w)
+}
+
+// WriteSCXML() writes definition to w as SCXML document.
+func WriteSCXML(definition *Definition, w io.Writer) error {
+	doc := &scxmlDocument{
+		XMLNS:   SCXMLNamespace,
+		Version: "1.0",
+		Name:    definition.Name,
+		Initial: definition.Initial,
+	}
+	for _, state := range definition.States {
+		doc.States = append(doc.States, newSCXMLState(state))
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func newSCXMLState(def *StateDefinition) *scxmlState {
+	state := &scxmlState{
+		XMLName: xml.Name{Local: "state"},
+		ID:      def.ID,
+		Initial: def.Initial,
+	}
+	if def.Final {
+		state.XMLName.Local = "final"
+	}
+	if def.History != "" {
+		state.XMLName.Local = "history"
+		state.Type = def.History
+		state.Initial = ""
+		if def.Initial != "" {
+			state.Transitions = []*scxmlTransition{{Target: def.Initial}}
+		}
+		return state
+	}
+	if len(def.Entry) != 0 {
+		state.OnEntry = []*scxmlExecutable{{Scripts: def.Entry}}
+	}
+	if len(def.Exit) != 0 {
+		state.OnExit = []*scxmlExecutable{{Scripts: def.Exit}}
+	}
+	for _, tran := range def.Transitions {
+		state.Transitions = append(state.Transitions, &scxmlTransition{
+			Event:   tran.Event,
+			Target:  tran.Target,
+			Cond:    tran.Guard,
+			Scripts: tran.Actions,
+		})
+	}
+	for _, child := range def.States {
+		state.States = append(state.States, newSCXMLState(child))
+	}
+	return state
+}
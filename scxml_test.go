@@ -0,0 +1,100 @@
+package hsm
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const testSCXML = `<?xml version="1.0" encoding="UTF-8"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" name="door" initial="closed">
+  <state id="closed">
+    <onentry><script>lightOff</script></onentry>
+    <transition event="open" target="opened" cond="unlocked">
+      <script>beep</script>
+    </transition>
+    <transition event="lock" target="locked"></transition>
+  </state>
+  <state id="opened">
+    <onexit><script>beep</script></onexit>
+    <transition event="close" target="closed"></transition>
+  </state>
+  <state id="locked">
+    <initial><transition target="locked_quiet"></transition></initial>
+    <state id="locked_alarm"></state>
+    <state id="locked_quiet"></state>
+    <transition event="unlock" target="closed"></transition>
+  </state>
+  <final id="broken"></final>
+</scxml>
+`
+
+func TestLoadSCXML(t *testing.T) {
+	var log []string
+	record := func(name string) Action {
+		return func(sm HSM, event Event) {
+			log = append(log, name+"@"+EventName(event.Type()))
+		}
+	}
+	bindings := &Bindings{
+		Actions: map[string]Action{
+			"lightOff": record("lightOff"),
+			"beep":     record("beep"),
+		},
+		Guards: map[string]Guard{
+			"unlocked": func(sm HSM, event Event) bool { return true },
+		},
+	}
+	sm, err := LoadSCXML(strings.NewReader(testSCXML), bindings)
+	assert.Nil(t, err)
+	sm.Init()
+	assert.Equal(t, "closed", sm.GetState().ID())
+	sm.Dispatch(NewStdEvent(InternEventType("open")))
+	assert.Equal(t, "opened", sm.GetState().ID())
+	sm.Dispatch(NewStdEvent(InternEventType("close")))
+	sm.Dispatch(NewStdEvent(InternEventType("lock")))
+	assert.Equal(t, "locked_quiet", sm.GetState().ID())
+	assert.Equal(t, []string{
+		"lightOff@Entry", "beep@open", "beep@Exit", "lightOff@Entry",
+	}, log)
+
+	// unbound names are rejected
+	_, err = LoadSCXML(strings.NewReader(testSCXML), nil)
+	assert.NotNil(t, err)
+}
+
+func TestSCXMLRoundTrip(t *testing.T) {
+	definition, err := ReadSCXML(strings.NewReader(testSCXML))
+	assert.Nil(t, err)
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSCXML(definition, &buf))
+	again, err := ReadSCXML(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, definition, again)
+
+	// export the structure of machine written in Go
+	var log []string
+	sm := newTestHSM(&log)
+	buf.Reset()
+	assert.Nil(t, ExportSCXML(sm, &buf))
+	out := buf.String()
+	assert.Contains(t, out,
+		`<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" initial="s0">`)
+	assert.Contains(t, out, `<state id="s21" initial="s211">`)
+	assert.Contains(t, out, `<transition event="G" target="s0"></transition>`)
+	assert.Contains(t, out, `<final id="Terminal"></final>`)
+	definition, err = ReadSCXML(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, DefinitionOf(sm), definition)
+}
+
+func TestSCXMLHistory(t *testing.T) {
+	definition := newHistoryDefinition()
+	var buf bytes.Buffer
+	assert.Nil(t, WriteSCXML(definition, &buf))
+	assert.Contains(t, buf.String(), `<history id="hd" type="deep">`)
+	again, err := ReadSCXML(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, definition, again)
+}
@@ -0,0 +1,247 @@
+package hsm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// SnapshotVersion is the version of snapshot format written by Snapshot().
+const SnapshotVersion = 1
+
+// Snapshot is the serializable state of a state machine, which is taken
+// at rest between two events. It's tagged for JSON, and could be written
+// by gob as well.
+//
+// Besides the active configuration, the states recorded by the history
+// pseudo-states are saved, so that the transitions to them resume the same
+// states after restored. StdHSM has no timers of its own, so there are
+// no pending timers in a snapshot: the timers armed by actions through
+// Clock are not saved, and should be armed again after Restore().
+type Snapshot struct {
+	// The version of snapshot format
+	Version int `json:"version"`
+	// The type of the state machine taken from
+	Type HSMType `json:"type"`
+	// The definition version of the state machine taken from
+	DefinitionVersion int `json:"definitionVersion,omitempty"`
+	// The ID of current state
+	StateID string `json:"state"`
+	// The IDs of the active states from the top-most one down to
+	// the current state, TOP excluded
+	Configuration []string `json:"configuration"`
+	// The IDs of the states recorded by the history pseudo-states, by
+	// the IDs of the histories, see History.Resume()
+	History map[string]string `json:"history,omitempty"`
+	// The extended state encoded by codec, empty if there is none
+	Data []byte `json:"data,omitempty"`
+	// The sequence number of the last event applied, set by Journal
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// Codec encodes and decodes the extended state in snapshots.
+type Codec interface {
+	Encode(v interface{}) ([]byte, error)
+	Decode(data []byte, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// The codecs provided. JSONCodec is used when nil codec is given.
+var (
+	JSONCodec Codec = jsonCodec{}
+	GobCodec  Codec = gobCodec{}
+)
+
+// ExtendedState is implemented by the state machines which keep data
+// besides the current state, usually in the struct wrapping StdHSM.
+type ExtendedState interface {
+	// Returns a pointer to the data, which the snapshot is encoded from
+	// and decoded into.
+	ExtendedState() interface{}
+}
+
+// Snapshot() is a helper function to take snapshot of StdHSM itself.
+func (self *StdHSM) Snapshot(codec Codec) (*Snapshot, error) {
+	return self.Snapshot2(self, codec)
+}
+
+// Snapshot2() takes the snapshot of the state machine hsm, which must
+// be initialized and not in the middle of dispatching. The extended
+// state of hsm is encoded by codec if hsm implements ExtendedState.
+func (self *StdHSM) Snapshot2(hsm HSM, codec Codec) (*Snapshot, error) {
+	AssertNotEqual(self.StateTable[TopStateID], self.State)
+	snapshot := &Snapshot{
+		Version:           SnapshotVersion,
+		Type:              self.MyType,
+		DefinitionVersion: self.DefinitionVersion,
+		StateID:           self.State.ID(),
+		Configuration:     configurationOf(self.State),
+	}
+	for _, histories := range self.histories {
+		for _, h := range histories {
+			if h.last == "" {
+				continue
+			}
+			if snapshot.History == nil {
+				snapshot.History = make(map[string]string)
+			}
+			snapshot.History[h.ID()] = h.last
+		}
+	}
+	if extended, ok := hsm.(ExtendedState); ok {
+		if codec == nil {
+			codec = JSONCodec
+		}
+		data, err := codec.Encode(extended.ExtendedState())
+		if err != nil {
+			return nil, fmt.Errorf("encode extended state: %v", err)
+		}
+		snapshot.Data = data
+	}
+	return snapshot, nil
+}
+
+// Restore() is a helper function to restore StdHSM itself.
+func (self *StdHSM) Restore(snapshot *Snapshot, codec Codec) error {
+	return self.Restore2(self, snapshot, codec)
+}
+
+// Restore2() resumes the state machine hsm from snapshot. It's called
+// in place of Init() on a new state machine. Neither the initial
+// transitions nor the entry actions are triggered, since the states
+// restored were entered before the snapshot was taken.
+// A snapshot of older definition version is migrated by Migrate() first.
+func (self *StdHSM) Restore2(hsm HSM, snapshot *Snapshot, codec Codec) error {
+	// check HSM is not executed yet
+	AssertEqual(self.StateTable[TopStateID], self.State)
+	AssertEqual(self.StateTable[InitialStateID], self.SourceState)
+	snapshot, err := self.Migrate(snapshot)
+	if err != nil {
+		return err
+	}
+	if extended, ok := hsm.(ExtendedState); ok && len(snapshot.Data) != 0 {
+		if codec == nil {
+			codec = JSONCodec
+		}
+		if err := codec.Decode(snapshot.Data, extended.ExtendedState()); err != nil {
+			return fmt.Errorf("decode extended state: %v", err)
+		}
+	}
+	for _, histories := range self.histories {
+		for _, h := range histories {
+			h.Reset()
+		}
+	}
+	for id, last := range snapshot.History {
+		self.StateTable[id].(*History).last = last
+	}
+	self.State = self.StateTable[snapshot.StateID]
+	self.SourceState = self.State
+	return nil
+}
+
+// CheckSnapshot() tests whether snapshot could be restored to this
+// state machine, that is, it's of the known format and type, and
+// its configuration is legal in this state machine.
+func (self *StdHSM) CheckSnapshot(snapshot *Snapshot) error {
+	if snapshot.Version != SnapshotVersion {
+		return fmt.Errorf("unknown snapshot version %d", snapshot.Version)
+	}
+	if snapshot.Type != self.MyType {
+		return fmt.Errorf("snapshot of HSM type %d, expected %d",
+			snapshot.Type, self.MyType)
+	}
+	if snapshot.DefinitionVersion != self.DefinitionVersion {
+		return fmt.Errorf("snapshot of definition version %d, expected %d",
+			snapshot.DefinitionVersion, self.DefinitionVersion)
+	}
+	state, ok := self.StateTable[snapshot.StateID]
+	if !ok || snapshot.StateID == TopStateID ||
+		snapshot.StateID == InitialStateID {
+		return fmt.Errorf("unknown state %q in snapshot", snapshot.StateID)
+	}
+	if len(state.Children()) != 0 {
+		return fmt.Errorf("state %q in snapshot is not a leaf state",
+			snapshot.StateID)
+	}
+	for id, last := range snapshot.History {
+		if err := self.checkHistory(id, last); err != nil {
+			return err
+		}
+	}
+	expected := configurationOf(state)
+	if len(expected) != len(snapshot.Configuration) {
+		return fmt.Errorf("configuration %v in snapshot, expected %v",
+			snapshot.Configuration, expected)
+	}
+	for i, id := range expected {
+		if snapshot.Configuration[i] != id {
+			return fmt.Errorf("configuration %v in snapshot, expected %v",
+				snapshot.Configuration, expected)
+		}
+	}
+	return nil
+}
+
+// configurationOf() returns the IDs of state and all its super states
+// from the top-most one down, TOP excluded.
+func configurationOf(state State) []string {
+	var ids []string
+	for s := state; s != nil && s.ID() != TopStateID; s = s.Super() {
+		ids = append([]string{s.ID()}, ids...)
+	}
+	return ids
+}
+
+// checkHistory() tests whether the history id could have recorded
+// the state last.
+func (self *StdHSM) checkHistory(id, last string) error {
+	h, ok := self.StateTable[id].(*History)
+	if !ok {
+		return fmt.Errorf("unknown history %q in snapshot", id)
+	}
+	state, ok := self.StateTable[last]
+	if _, isHistory := state.(*History); !ok || isHistory {
+		return fmt.Errorf("unknown state %q of history %q in snapshot",
+			last, id)
+	}
+	if h.Deep && len(state.Children()) != 0 {
+		return fmt.Errorf("state %q of deep history %q in snapshot "+
+			"is not a leaf state", last, id)
+	}
+	for s := state.Super(); s != nil; s = s.Super() {
+		if s == h.Super() {
+			if !h.Deep && state.Super() != s {
+				return fmt.Errorf("state %q of shallow history %q "+
+					"in snapshot is not a child of %q", last, id, s.ID())
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("state %q of history %q in snapshot is not "+
+		"a descendant of %q", last, id, h.Super().ID())
+}
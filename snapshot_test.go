@@ -0,0 +1,163 @@
+package hsm
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventC))
+	assert.Equal(t, "s211", sm.State.ID())
+	snapshot, err := sm.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"s0", "s2", "s21", "s211"}, snapshot.Configuration)
+	assert.Nil(t, snapshot.Data)
+	data, err := json.Marshal(snapshot)
+	assert.Nil(t, err)
+
+	var decoded Snapshot
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	var restoredLog []string
+	restored := newTestHSM(&restoredLog)
+	assert.Nil(t, restored.Restore(&decoded, nil))
+	// neither init nor entry is replayed
+	assert.Equal(t, 0, len(restoredLog))
+	assert.Equal(t, "s211", restored.State.ID())
+	assert.True(t, restored.IsIn("s2"))
+	restored.Dispatch(NewStdEvent(testEventG))
+	assert.Equal(t, "s11", restored.State.ID())
+	assert.Equal(t, []string{
+		"s211-Exit", "s21-Exit", "s2-Exit", "s0-Init", "s1-Entry",
+		"s1-Init", "s11-Entry"}, restoredLog)
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	sm.Init()
+	snapshot, err := sm.Snapshot(nil)
+	assert.Nil(t, err)
+	for _, c := range []struct {
+		modify func(s *Snapshot)
+	}{
+		{func(s *Snapshot) { s.Version = 0 }},
+		{func(s *Snapshot) { s.Type = HSMTypeUser }},
+		{func(s *Snapshot) { s.StateID = "s3" }},
+		{func(s *Snapshot) { s.StateID = InitialStateID }},
+		{func(s *Snapshot) { s.StateID = "s1" }},
+		{func(s *Snapshot) { s.Configuration = []string{"s11"} }},
+		{func(s *Snapshot) { s.Configuration = []string{"s0", "s2", "s11"} }},
+	} {
+		modified := *snapshot
+		c.modify(&modified)
+		assert.NotNil(t, newTestHSM(&log).Restore(&modified, nil))
+	}
+}
+
+type testExtendedHSM struct {
+	*StdHSM
+	Data struct {
+		Count int
+		Name  string
+	}
+}
+
+func (self *testExtendedHSM) ExtendedState() interface{} {
+	return &self.Data
+}
+
+func TestSnapshotExtendedState(t *testing.T) {
+	var log []string
+	for _, codec := range []Codec{JSONCodec, GobCodec} {
+		sm := &testExtendedHSM{StdHSM: newTestHSM(&log)}
+		sm.Init()
+		sm.Data.Count = 3
+		sm.Data.Name = "foo"
+		snapshot, err := sm.Snapshot2(sm, codec)
+		assert.Nil(t, err)
+		assert.NotNil(t, snapshot.Data)
+		restored := &testExtendedHSM{StdHSM: newTestHSM(&log)}
+		assert.Nil(t, restored.Restore2(restored, snapshot, codec))
+		assert.Equal(t, sm.Data, restored.Data)
+		assert.Equal(t, "s11", restored.State.ID())
+	}
+}
+
+func TestSnapshotHistory(t *testing.T) {
+	newHistoryHSM := func() *StdHSM {
+		sm, err := Build(newHistoryDefinition(), nil)
+		assert.Nil(t, err)
+		return sm
+	}
+	dispatch := func(sm *StdHSM, name string) string {
+		sm.Dispatch(StdEventOf(InternEventType(name)))
+		return sm.State.ID()
+	}
+	sm := newHistoryHSM()
+	sm.Init()
+	assert.Equal(t, "b1", dispatch(sm, "N"))
+	assert.Equal(t, "b2", dispatch(sm, "N"))
+	assert.Equal(t, "s2", dispatch(sm, "X"))
+	snapshot, err := sm.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"h": "b", "hd": "b2"}, snapshot.History)
+	data, err := json.Marshal(snapshot)
+	assert.Nil(t, err)
+
+	for _, c := range []struct {
+		event    string
+		expected string
+	}{
+		// shallow history resumes b, which is initialized to b1
+		{"Y", "b1"},
+		// deep history resumes b2
+		{"Z", "b2"},
+	} {
+		var decoded Snapshot
+		assert.Nil(t, json.Unmarshal(data, &decoded))
+		restored := newHistoryHSM()
+		assert.Nil(t, restored.Restore(&decoded, nil))
+		assert.Equal(t, "s2", restored.State.ID())
+		assert.Equal(t, c.expected, dispatch(restored, c.event))
+	}
+
+	// no history is saved before any is recorded
+	fresh := newHistoryHSM()
+	fresh.Init()
+	snapshot, err = fresh.Snapshot(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, snapshot.History)
+}
+
+func TestRestoreInvalidHistory(t *testing.T) {
+	sm, err := Build(newHistoryDefinition(), nil)
+	assert.Nil(t, err)
+	sm.Init()
+	snapshot, err := sm.Snapshot(nil)
+	assert.Nil(t, err)
+	for _, history := range []map[string]string{
+		// not a history
+		{"a": "b"},
+		// unknown state
+		{"h": "c"},
+		// a history is never recorded
+		{"h": "hd"},
+		// not a child of s1
+		{"h": "b1"},
+		{"h": "s2"},
+		// not a leaf state
+		{"hd": "b"},
+		// not a descendant of s1
+		{"hd": "s2"},
+	} {
+		modified := *snapshot
+		modified.History = history
+		restored, err := Build(newHistoryDefinition(), nil)
+		assert.Nil(t, err)
+		assert.NotNil(t, restored.Restore(&modified, nil), history)
+	}
+}
@@ -1,7 +1,5 @@
 package hsm
 
-import "container/list"
-
 // state IDs for all the default states
 const (
 	TopStateID      = "TOP"
@@ -39,40 +37,52 @@ type State interface {
 type StateHead struct {
 	// pointer to parent state
 	super State
-	// links to all children state
-	children *list.List
+	// all children states in the order added
+	children []State
+	// the index in StdHSM.States
+	index int
 }
 
 // NewStateHead() is the constructor for StateHead.
 func NewStateHead(super State) *StateHead {
-	children := list.New()
 	return &StateHead{
-		super:    super,
-		children: children,
+		super: super,
 	}
 }
 
+// indexed is implemented by StateHead, and so by every state which
+// embeds StateHead, to keep its index in StdHSM.States.
+type indexed interface {
+	stateIndex() int
+	setStateIndex(index int)
+}
+
+func (self *StateHead) stateIndex() int {
+	return self.index
+}
+
+func (self *StateHead) setStateIndex(index int) {
+	self.index = index
+}
+
 // Super() is part of interface State.
 func (self *StateHead) Super() State {
 	return self.super
 }
 
 // Children() is part of interface State.
+// The slice returned is shared without copying, and must not be modified.
 func (self *StateHead) Children() []State {
-	length := self.children.Len()
-	children := make([]State, 0, length)
-	for e := self.children.Front(); e != nil; e = e.Next() {
-		state, ok := e.Value.(State)
-		AssertTrue(ok)
-		children = append(children, state)
-	}
-	return children
+	// limit the capacity so that appending to it never overwrites
+	return self.children[:len(self.children):len(self.children)]
 }
 
 // AddChild() is part of interface State.
 func (self *StateHead) AddChild(child State) {
-	AssertFalse(ListIn(self.children, child))
-	self.children.PushBack(child)
+	for _, state := range self.children {
+		AssertTrue(state != child)
+	}
+	self.children = append(self.children, child)
 }
 
 // Init() is part of interface State.
@@ -170,3 +180,73 @@ func (self *Terminal) Handle(hsm HSM, event Event) (state State) {
 	// Events dispatched to terminal state are not handled by default.
 	return self.Super()
 }
+
+// History is the history pseudo-state of its super state. A transition
+// targeting it resumes the configuration its super state was in when
+// last exited: the child state for shallow history, or the leaf state
+// for deep history. Before the super state is ever exited, it goes to
+// DefaultStateID instead. It never becomes the current state.
+type History struct {
+	*StateHead
+	HistoryID string
+	// Whether to resume the leaf state rather than the child state
+	Deep bool
+	// The state to go to when there is no history yet
+	DefaultStateID string
+	// the state to resume, empty if there is no history yet
+	last string
+}
+
+func NewHistory(
+	super State, id string, deep bool, defaultStateID string) *History {
+
+	object := &History{
+		StateHead:      NewStateHead(super),
+		HistoryID:      id,
+		Deep:           deep,
+		DefaultStateID: defaultStateID,
+	}
+	super.AddChild(object)
+	return object
+}
+
+func (self *History) ID() string {
+	return self.HistoryID
+}
+
+func (self *History) Handle(hsm HSM, event Event) (state State) {
+	// History is resolved before transfer, and never becomes current.
+	// It should never run here.
+	AssertTrue(false)
+	return self.Super()
+}
+
+// Resume() returns the ID of the state a transition targeting this
+// history goes to.
+func (self *History) Resume() string {
+	if self.last != "" {
+		return self.last
+	}
+	return self.DefaultStateID
+}
+
+// Reset() forgets the history.
+func (self *History) Reset() {
+	self.last = ""
+}
+
+// record() remembers the configuration below the super state, whose
+// current leaf state is leaf, when the super state is exited.
+func (self *History) record(leaf State) {
+	super := self.Super()
+	for s := leaf; s != nil && s != super; s = s.Super() {
+		if s.Super() == super {
+			if self.Deep {
+				self.last = leaf.ID()
+			} else {
+				self.last = s.ID()
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package hsm
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// newWarnedTestHSM() builds the test state machine whose warnings are
+// collected into warnings.
+func newWarnedTestHSM(log, warnings *[]string) *StdHSM {
+	sm := newTestHSM(log)
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceWarning {
+			*warnings = append(*warnings, record.Message)
+		}
+	}))
+	return sm
+}
+
+func TestStaticTransitionInitUnhandled(t *testing.T) {
+	var log, warnings []string
+	sm := newWarnedTestHSM(&log, &warnings)
+	sm.Init()
+	event := NewStdEvent(testEventC)
+	// set up the chains s11 -> s2 and s211 -> s1
+	sm.Dispatch(event)
+	assert.Equal(t, "s211", sm.GetState().ID())
+	sm.Dispatch(event)
+	assert.Equal(t, 0, len(warnings))
+	// s2 stops its initial transition in s2 from now on
+	sm.StateTable["s2"].(*testState).init = ""
+	log = nil
+	sm.Dispatch(event)
+	assert.Equal(t, "s2", sm.GetState().ID())
+	assert.Equal(t, []string{"s11-Exit", "s1-Exit", "s2-Entry"}, log)
+	assert.Equal(t, []string{"non-deterministic s2-Init, unhandled but " +
+		"handled when recorded: transition from s1 to s2 falls back " +
+		"to dynamic"}, warnings)
+	chain := sm.cachedTran(sm.StateTable["s1"], sm.StateTable["s2"])
+	assert.True(t, chain.Dynamic)
+	// the dynamic path is taken afterwards without more warnings
+	sm.Dispatch(event)
+	assert.Equal(t, "s11", sm.GetState().ID())
+	log = nil
+	sm.Dispatch(event)
+	assert.Equal(t, "s2", sm.GetState().ID())
+	assert.Equal(t, []string{"s11-Exit", "s1-Exit", "s2-Entry"}, log)
+	assert.Equal(t, 1, len(warnings))
+}
+
+func TestStaticTransitionInitChanged(t *testing.T) {
+	var log, warnings []string
+	sm := newWarnedTestHSM(&log, &warnings)
+	sm.Init()
+	// set up the chains s11 -> s211 and s211 -> s0
+	sm.Dispatch(NewStdEvent(testEventG))
+	sm.Dispatch(NewStdEvent(testEventG))
+	assert.Equal(t, "s11", sm.GetState().ID())
+	sm.Dispatch(NewStdEvent(testEventG))
+	assert.Equal(t, 0, len(warnings))
+	// s0 initializes to s2 rather than s1 from now on
+	sm.StateTable["s0"].(*testState).init = "s2"
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventG))
+	assert.Equal(t, "s211", sm.GetState().ID())
+	assert.Equal(t, []string{
+		"s211-Exit", "s21-Exit", "s2-Exit", "s0-Init", "s2-Entry",
+		"s2-Init", "s21-Entry", "s21-Init", "s211-Entry"}, log)
+	assert.Equal(t, 1, len(warnings))
+	assert.Contains(t, warnings[0], "s0-Init")
+}
+
+// testConditionalState handles its exit action only when exits is odd.
+type testConditionalState struct {
+	*testState
+	exits int
+}
+
+func (self *testConditionalState) Exit(sm HSM, event Event) State {
+	self.exits++
+	if self.exits%2 == 0 {
+		return self.Super()
+	}
+	return self.testState.Exit(sm, event)
+}
+
+func TestStaticTransitionExitChanged(t *testing.T) {
+	var log, warnings []string
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	s1 := &testConditionalState{testState: &testState{
+		StateHead: NewStateHead(top),
+		id:        "s1",
+		trans:     map[EventType]string{testEventA: "s2"},
+		log:       &log,
+	}}
+	top.AddChild(s1)
+	newTestState(top, "s2", "", map[EventType]string{testEventA: "s1"}, &log)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.AddObserver(ObserverFunc(func(record *TraceRecord) {
+		if record.Kind == TraceWarning {
+			warnings = append(warnings, record.Message)
+		}
+	}))
+	sm.Init()
+	event := NewStdEvent(testEventA)
+	sm.Dispatch(event)
+	sm.Dispatch(event)
+	assert.Equal(t, 0, len(warnings))
+	// the exit of s1 is unhandled this time
+	log = nil
+	sm.Dispatch(event)
+	assert.Equal(t, []string{"s2-Entry"}, log)
+	assert.Equal(t, "s2", sm.GetState().ID())
+	assert.Equal(t, []string{"non-deterministic s1-Exit, unhandled but " +
+		"handled when recorded: transition from s1 to s2 falls back " +
+		"to dynamic"}, warnings)
+	// and handled the next time on the dynamic path
+	sm.Dispatch(event)
+	log = nil
+	sm.Dispatch(event)
+	assert.Equal(t, []string{"s1-Exit", "s2-Entry"}, log)
+	assert.Equal(t, 1, len(warnings))
+}
+
+func TestPrecompiledChainRecorded(t *testing.T) {
+	var warnings []string
+	sm := newWarnedTestHSM(nil, &warnings)
+	sm.PrecompileTransition("s1", "s2")
+	chain := sm.cachedTran(sm.StateTable["s1"], sm.StateTable["s2"])
+	assert.False(t, chain.Recorded)
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventC))
+	assert.True(t, chain.Recorded)
+	for _, action := range chain.Actions {
+		assert.True(t, action.Handled)
+	}
+	assert.Equal(t, 0, len(warnings))
+}
+
+func TestStaticTransitionNoAllocation(t *testing.T) {
+	sm := newTestHSM(nil)
+	sm.Init()
+	event := NewStdEvent(testEventC)
+	// set up the chains s11 -> s2 and s211 -> s1
+	sm.Dispatch(event)
+	sm.Dispatch(event)
+	allocs := testing.AllocsPerRun(100, func() {
+		sm.Dispatch(event)
+	})
+	assert.Equal(t, 0.0, allocs)
+}
@@ -0,0 +1,274 @@
+package hsm
+
+import (
+	"container/list"
+)
+
+// TranCache caches the static transfer chains of state machines, keyed by
+// the indexes of source and target states in StdHSM.States. A cache could
+// be shared by the instances of the same definition, see ShareTranCache().
+// It's not safe for concurrent use, and neither are the chains in it,
+// which are updated on replay.
+type TranCache interface {
+	// Returns the chain from source to target, nil if it's not cached
+	Get(source, target int) *StaticTranChain
+	// Caches the chain from source to target
+	Put(source, target int, chain *StaticTranChain)
+	// Drops all the chains cached
+	Invalidate()
+	Stats() TranCacheStats
+}
+
+// TranCacheStats is the statistics of a TranCache.
+type TranCacheStats struct {
+	// The number of Get() which found a chain
+	Hits uint64
+	// The number of Get() which found nothing
+	Misses uint64
+	// The number of chains cached
+	Size int
+}
+
+// UnboundedTranCache caches every chain put, in a table indexed by
+// the source and target states. It's the default TranCache.
+type UnboundedTranCache struct {
+	// the row of a source is allocated on its first Put()
+	table [][]*StaticTranChain
+	stats TranCacheStats
+}
+
+// Constructor for UnboundedTranCache.
+func NewUnboundedTranCache() *UnboundedTranCache {
+	return &UnboundedTranCache{}
+}
+
+// Get() is part of interface TranCache.
+func (self *UnboundedTranCache) Get(source, target int) *StaticTranChain {
+	if source < len(self.table) && target < len(self.table[source]) {
+		if chain := self.table[source][target]; chain != nil {
+			self.stats.Hits++
+			return chain
+		}
+	}
+	self.stats.Misses++
+	return nil
+}
+
+// Put() is part of interface TranCache.
+func (self *UnboundedTranCache) Put(source, target int, chain *StaticTranChain) {
+	if source >= len(self.table) {
+		table := make([][]*StaticTranChain, source+1)
+		copy(table, self.table)
+		self.table = table
+	}
+	row := self.table[source]
+	if target >= len(row) {
+		row = make([]*StaticTranChain, target+1)
+		copy(row, self.table[source])
+		self.table[source] = row
+	}
+	if row[target] == nil {
+		self.stats.Size++
+	}
+	row[target] = chain
+}
+
+// Invalidate() is part of interface TranCache.
+func (self *UnboundedTranCache) Invalidate() {
+	self.table = nil
+	self.stats.Size = 0
+}
+
+// Stats() is part of interface TranCache.
+func (self *UnboundedTranCache) Stats() TranCacheStats {
+	return self.stats
+}
+
+// tranKey is the key of chains in LRUTranCache.
+type tranKey struct {
+	source int
+	target int
+}
+
+// lruEntry is the value of the elements in LRUTranCache.
+type lruEntry struct {
+	key   tranKey
+	chain *StaticTranChain
+}
+
+// LRUTranCache caches at most Capacity chains. The least recently used
+// chain is evicted to put a new one when it's full.
+type LRUTranCache struct {
+	Capacity int
+	// the elements in the order of use, the most recent one in front
+	order *list.List
+	index map[tranKey]*list.Element
+	stats TranCacheStats
+}
+
+// Constructor for LRUTranCache.
+func NewLRUTranCache(capacity int) *LRUTranCache {
+	AssertTrue(capacity > 0)
+	return &LRUTranCache{
+		Capacity: capacity,
+		order:    list.New(),
+		index:    make(map[tranKey]*list.Element, capacity),
+	}
+}
+
+// Get() is part of interface TranCache.
+func (self *LRUTranCache) Get(source, target int) *StaticTranChain {
+	element, ok := self.index[tranKey{source, target}]
+	if !ok {
+		self.stats.Misses++
+		return nil
+	}
+	self.stats.Hits++
+	self.order.MoveToFront(element)
+	return element.Value.(*lruEntry).chain
+}
+
+// Put() is part of interface TranCache.
+func (self *LRUTranCache) Put(source, target int, chain *StaticTranChain) {
+	key := tranKey{source, target}
+	if element, ok := self.index[key]; ok {
+		element.Value.(*lruEntry).chain = chain
+		self.order.MoveToFront(element)
+		return
+	}
+	if self.order.Len() >= self.Capacity {
+		oldest := self.order.Back()
+		delete(self.index, oldest.Value.(*lruEntry).key)
+		self.order.Remove(oldest)
+	}
+	self.index[key] = self.order.PushFront(&lruEntry{key, chain})
+}
+
+// Invalidate() is part of interface TranCache.
+func (self *LRUTranCache) Invalidate() {
+	self.order.Init()
+	self.index = make(map[tranKey]*list.Element, self.Capacity)
+}
+
+// Stats() is part of interface TranCache.
+func (self *LRUTranCache) Stats() TranCacheStats {
+	stats := self.stats
+	stats.Size = self.order.Len()
+	return stats
+}
+
+// DisabledTranCache caches nothing, so that every static transfer
+// searches the LCA like a dynamic one.
+type DisabledTranCache struct {
+	stats TranCacheStats
+}
+
+// Get() is part of interface TranCache.
+func (self *DisabledTranCache) Get(source, target int) *StaticTranChain {
+	self.stats.Misses++
+	return nil
+}
+
+// Put() is part of interface TranCache.
+func (self *DisabledTranCache) Put(source, target int, chain *StaticTranChain) {
+}
+
+// Invalidate() is part of interface TranCache.
+func (self *DisabledTranCache) Invalidate() {
+}
+
+// Stats() is part of interface TranCache.
+func (self *DisabledTranCache) Stats() TranCacheStats {
+	return self.stats
+}
+
+// SetTranCache() sets the cache of static transfer chains, which is
+// an UnboundedTranCache by default.
+func (self *StdHSM) SetTranCache(cache TranCache) {
+	AssertNotNil(cache)
+	self.tranCache = cache
+}
+
+// TranCache() returns the cache of static transfer chains.
+func (self *StdHSM) TranCache() TranCache {
+	return self.tranCache
+}
+
+// ShareTranCache() makes this state machine use the cache of other,
+// which must be an instance of the same definition, so that the chains
+// set up by either are replayed by both.
+func (self *StdHSM) ShareTranCache(other *StdHSM) {
+	AssertEqual(len(other.States), len(self.States))
+	AssertEqual(other.DefinitionVersion, self.DefinitionVersion)
+	for i, state := range self.States {
+		AssertTrue(state.ID() == other.States[i].ID())
+	}
+	self.tranCache = other.tranCache
+}
+
+// InvalidateTransitions() indexes the states again and drops all
+// the chains cached. It must be called after the state hierarchy is
+// changed, e.g. by AddChild(). The state machines sharing the cache must
+// be changed in the same way.
+func (self *StdHSM) InvalidateTransitions() {
+	top := self.StateTable[TopStateID]
+	self.StateTable = make(map[string]State)
+	self.States = self.States[:0]
+	self.Indexes = make(map[State]int)
+	self.Parents = self.Parents[:0]
+	self.Depths = self.Depths[:0]
+	self.setupStateTable(top)
+	self.tranCache.Invalidate()
+}
+
+// StaticTrans() returns the chains cached by the IDs of their source and
+// target states. It's a copy, changing which affects nothing. Only the
+// chains of UnboundedTranCache and LRUTranCache are listed, without
+// counting as hits or being used.
+//
+// Deprecated: the chains are cached in TranCache, see SetTranCache().
+func (self *StdHSM) StaticTrans() map[StaticTranID]*StaticTranChain {
+	trans := make(map[StaticTranID]*StaticTranChain)
+	if cache, ok := self.tranCache.(tranCacheWalker); ok {
+		cache.walk(func(source, target int, chain *StaticTranChain) {
+			trans[StaticTranID{
+				SourceState: self.States[source].ID(),
+				TargetState: self.States[target].ID(),
+			}] = chain
+		})
+	}
+	return trans
+}
+
+// tranCacheWalker is implemented by the caches of this package which
+// could list their chains, for StaticTrans().
+type tranCacheWalker interface {
+	walk(f func(source, target int, chain *StaticTranChain))
+}
+
+func (self *UnboundedTranCache) walk(
+	f func(source, target int, chain *StaticTranChain)) {
+
+	for source, row := range self.table {
+		for target, chain := range row {
+			if chain != nil {
+				f(source, target, chain)
+			}
+		}
+	}
+}
+
+func (self *LRUTranCache) walk(
+	f func(source, target int, chain *StaticTranChain)) {
+
+	for e := self.order.Front(); e != nil; e = e.Next() {
+		entry := e.Value.(*lruEntry)
+		f(entry.key.source, entry.key.target, entry.chain)
+	}
+}
+
+// cachedTran() returns the chain cached from source to target, nil if
+// there is none.
+func (self *StdHSM) cachedTran(source, target State) *StaticTranChain {
+	return self.tranCache.Get(self.indexOf(source), self.indexOf(target))
+}
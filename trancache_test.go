@@ -0,0 +1,151 @@
+package hsm
+
+import (
+	"container/list"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// dispatchTestEvents() dispatches the events in turn to sm and returns
+// the IDs of states after every event.
+func dispatchTestEvents(sm *StdHSM, events ...EventType) []string {
+	var states []string
+	for _, event := range events {
+		sm.Dispatch(NewStdEvent(event))
+		states = append(states, sm.GetState().ID())
+	}
+	return states
+}
+
+var testCacheEvents = []EventType{
+	testEventC, testEventC, testEventE, testEventG, testEventC,
+	testEventF, testEventF, testEventC, testEventC, testEventG,
+}
+
+func TestUnboundedTranCache(t *testing.T) {
+	sm := newTestHSM(nil)
+	sm.Init()
+	dispatchTestEvents(sm, testCacheEvents...)
+	stats := sm.TranCache().Stats()
+	// s1 -> s2, s2 -> s1, s0 -> s211, s211 -> s0, s2 -> s11, s1 -> s211
+	assert.Equal(t, 6, stats.Size)
+	assert.Equal(t, uint64(6), stats.Misses)
+	assert.Equal(t, uint64(4), stats.Hits)
+}
+
+func TestLRUTranCache(t *testing.T) {
+	cache := NewLRUTranCache(2)
+	a, b, c := &StaticTranChain{}, &StaticTranChain{}, &StaticTranChain{}
+	cache.Put(0, 1, a)
+	cache.Put(1, 0, b)
+	assert.Same(t, a, cache.Get(0, 1))
+	// b is the least recently used
+	cache.Put(2, 0, c)
+	assert.Nil(t, cache.Get(1, 0))
+	assert.Same(t, a, cache.Get(0, 1))
+	assert.Same(t, c, cache.Get(2, 0))
+	assert.Equal(t, TranCacheStats{Hits: 3, Misses: 1, Size: 2}, cache.Stats())
+	cache.Invalidate()
+	assert.Nil(t, cache.Get(0, 1))
+	assert.Equal(t, 0, cache.Stats().Size)
+}
+
+func TestTranCachePolicies(t *testing.T) {
+	sm := newTestHSM(nil)
+	sm.Init()
+	expected := dispatchTestEvents(sm, testCacheEvents...)
+	for _, cache := range []TranCache{
+		NewLRUTranCache(2),
+		&DisabledTranCache{},
+	} {
+		var log, expectedLog []string
+		sm := newTestHSM(&expectedLog)
+		sm.Init()
+		other := newTestHSM(&log)
+		other.SetTranCache(cache)
+		other.Init()
+		for i, event := range testCacheEvents {
+			log, expectedLog = nil, nil
+			sm.Dispatch(NewStdEvent(event))
+			other.Dispatch(NewStdEvent(event))
+			assert.Equal(t, expectedLog, log)
+			assert.Equal(t, expected[i], other.GetState().ID())
+		}
+		assert.True(t, cache.Stats().Size <= 2)
+	}
+}
+
+func TestShareTranCache(t *testing.T) {
+	sm := newTestHSM(nil)
+	other := newTestHSM(nil)
+	other.ShareTranCache(sm)
+	sm.Init()
+	other.Init()
+	dispatchTestEvents(sm, testEventC)
+	dispatchTestEvents(other, testEventC)
+	// the chain set up by sm is replayed by other
+	stats := sm.TranCache().Stats()
+	assert.Equal(t, TranCacheStats{Hits: 1, Misses: 1, Size: 1}, stats)
+	assert.Equal(t, stats, other.TranCache().Stats())
+	assert.Equal(t, "s211", other.GetState().ID())
+}
+
+func TestInvalidateTransitions(t *testing.T) {
+	sm := newTestHSM(nil)
+	sm.Init()
+	dispatchTestEvents(sm, testEventC, testEventC)
+	assert.Equal(t, 2, sm.TranCache().Stats().Size)
+	// s1 initializes to the new child s12 from now on
+	s1 := sm.StateTable["s1"].(*testState)
+	newTestState(s1, "s12", "", nil, nil)
+	s1.init = "s12"
+	sm.InvalidateTransitions()
+	assert.Equal(t, 0, sm.TranCache().Stats().Size)
+	assert.Equal(t, sm.StateTable["s12"],
+		sm.States[sm.indexOf(sm.StateTable["s12"])])
+	states := dispatchTestEvents(sm, testEventC, testEventC, testEventC)
+	assert.Equal(t, []string{"s211", "s12", "s211"}, states)
+}
+
+func TestStaticTrans(t *testing.T) {
+	sm := newTestHSM(nil)
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventC))
+	stats := sm.TranCache().Stats()
+	trans := sm.StaticTrans()
+	assert.Equal(t, 1, len(trans))
+	chain := trans[StaticTranID{SourceState: "s1", TargetState: "s2"}]
+	assert.Same(t, sm.TranCache().Get(
+		sm.indexOf(sm.StateTable["s1"]), sm.indexOf(sm.StateTable["s2"])), chain)
+	// listing the chains doesn't count as hits
+	assert.Equal(t, stats.Hits, sm.TranCache().Stats().Hits-1)
+
+	sm.SetTranCache(NewLRUTranCache(4))
+	sm.Dispatch(NewStdEvent(testEventC))
+	_, ok := sm.StaticTrans()[StaticTranID{SourceState: "s2", TargetState: "s1"}]
+	assert.True(t, ok)
+	sm.SetTranCache(&DisabledTranCache{})
+	assert.Equal(t, 0, len(sm.StaticTrans()))
+}
+
+func TestRecord(t *testing.T) {
+	var log []string
+	sm := newTestHSM(&log)
+	actions := list.New()
+	RecordEntry(actions, sm, sm.StateTable["s1"], StdEvents[EventEntry])
+	RecordInit(actions, sm, sm.StateTable["s1"], StdEvents[EventInit])
+	// the init action of a leaf state is not handled, and not recorded
+	RecordInit(actions, sm, sm.StateTable["s11"], StdEvents[EventInit])
+	RecordExit(actions, sm, sm.StateTable["s1"], StdEvents[EventExit])
+	assert.Equal(t, []string{"s1-Entry", "s1-Init", "s1-Exit"}, log)
+	var recorded []StaticTranAction
+	for e := actions.Front(); e != nil; e = e.Next() {
+		recorded = append(recorded, *e.Value.(*StaticTranAction))
+	}
+	s1 := sm.indexOf(sm.StateTable["s1"])
+	assert.Equal(t, []StaticTranAction{
+		{State: s1, Event: EventEntry, Handled: true},
+		{State: s1, Event: EventInit, Handled: true},
+		{State: s1, Event: EventExit, Handled: true},
+	}, recorded)
+}
@@ -0,0 +1,188 @@
+package hsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TryEntry is implemented by the states whose entry actions could fail.
+// It's called in place of Entry(). An error returned aborts the transition
+// in transactional mode, see StdHSM.Transactional, or panics otherwise.
+type TryEntry interface {
+	TryEntry(hsm HSM, event Event) error
+}
+
+// TryExit is implemented by the states whose exit actions could fail.
+// It's called in place of Exit(), and the error is treated like TryEntry.
+type TryExit interface {
+	TryExit(hsm HSM, event Event) error
+}
+
+// TransitionError reports a transition aborted in transactional mode.
+type TransitionError struct {
+	// The event dispatched
+	Event Event
+	// The state whose action failed
+	StateID string
+	// The failed step, TraceEntry or TraceExit
+	Kind TraceKind
+	// The error returned by the action
+	Err error
+	// The steps done before the failure in order, e.g. "s1-Exit"
+	Steps []string
+	// The errors returned by the compensating exits and entries
+	Compensation []error
+}
+
+// Error() is part of interface error.
+func (self *TransitionError) Error() string {
+	message := fmt.Sprintf("transition on event %s failed at %s-%s: %v",
+		EventName(self.Event.Type()), self.StateID, self.Kind, self.Err)
+	if len(self.Steps) != 0 {
+		message += " after " + strings.Join(self.Steps, ", ")
+	}
+	return message
+}
+
+// Unwrap() returns the error returned by the action.
+func (self *TransitionError) Unwrap() error {
+	return self.Err
+}
+
+// transaction keeps track of a run-to-completion step in transactional
+// mode, to roll it back on failure.
+type transaction struct {
+	// the current state before dispatching
+	state State
+	// the length of Queue before dispatching
+	queued int
+	// the states entered in order
+	entered []State
+	// the states exited in order, including the one whose exit failed
+	exited []State
+	// the steps done in order
+	steps []string
+	// the states recorded by the histories before they are touched
+	history map[*History]string
+}
+
+// touch() saves the state recorded by h before it's changed.
+func (self *transaction) touch(h *History) {
+	if self.history == nil {
+		self.history = make(map[*History]string)
+	}
+	if _, ok := self.history[h]; !ok {
+		self.history[h] = h.last
+	}
+}
+
+// transactionAbort is panicked with to unwind a failed transition
+// to dispatch().
+type transactionAbort struct {
+	err *TransitionError
+}
+
+// transactional is implemented by StdHSM, and so by every HSM which
+// embeds StdHSM, to find the transaction in progress.
+type transactional interface {
+	transaction() *transaction
+}
+
+func (self *StdHSM) transaction() *transaction {
+	return self.tx
+}
+
+// step() completes the entry or exit action of state which returned err.
+func step(hsm HSM, kind TraceKind, state State, event Event, err error) {
+	var tx *transaction
+	if t, ok := hsm.(transactional); ok {
+		tx = t.transaction()
+	}
+	if err != nil {
+		if tx == nil {
+			panic(err)
+		}
+		panic(&transactionAbort{&TransitionError{
+			StateID: state.ID(),
+			Kind:    kind,
+			Err:     err,
+			Steps:   tx.steps,
+		}})
+	}
+	notify(hsm, kind, state, event)
+	if tx != nil {
+		tx.steps = append(tx.steps, state.ID()+"-"+kind.String())
+		if kind == TraceEntry {
+			tx.entered = append(tx.entered, state)
+		}
+	}
+}
+
+// begin() starts the transaction of dispatching an event.
+func (self *StdHSM) begin() {
+	self.Err = nil
+	self.tx = &transaction{
+		state:  self.State,
+		queued: len(self.Queue),
+	}
+}
+
+// commit() is deferred in dispatching to end the transaction. A failed
+// transition is rolled back: the states entered are exited in reverse
+// order, the states exited are entered again from the outermost one,
+// and the configuration and the histories before dispatching are restored.
+func (self *StdHSM) commit(hsm HSM, event Event) {
+	tx := self.tx
+	self.tx = nil
+	value := recover()
+	if value == nil {
+		return
+	}
+	abort, ok := value.(*transactionAbort)
+	if !ok {
+		panic(value)
+	}
+	err := abort.err
+	err.Event = event
+	for i := len(tx.entered) - 1; i >= 0; i-- {
+		state := tx.entered[i]
+		if s, ok := state.(TryExit); ok {
+			if e := s.TryExit(hsm, StdEvents[EventExit]); e != nil {
+				err.Compensation = append(err.Compensation, e)
+				continue
+			}
+		} else if state.Exit(hsm, StdEvents[EventExit]) != nil {
+			continue
+		}
+		self.exited(state)
+		notify(hsm, TraceExit, state, StdEvents[EventExit])
+	}
+	exited := tx.exited
+	if err.Kind == TraceExit {
+		// the state whose exit failed is not exited
+		exited = exited[:len(exited)-1]
+	}
+	for i := len(exited) - 1; i >= 0; i-- {
+		state := exited[i]
+		if s, ok := state.(TryEntry); ok {
+			if e := s.TryEntry(hsm, StdEvents[EventEntry]); e != nil {
+				err.Compensation = append(err.Compensation, e)
+				continue
+			}
+		} else if state.Entry(hsm, StdEvents[EventEntry]) != nil {
+			continue
+		}
+		self.entered(state)
+		notify(hsm, TraceEntry, state, StdEvents[EventEntry])
+	}
+	for h, last := range tx.history {
+		h.last = last
+	}
+	self.State = tx.state
+	self.SourceState = tx.state
+	if len(self.Queue) > tx.queued {
+		self.Queue = self.Queue[:tx.queued]
+	}
+	self.Err = err
+	self.Warn("%v", err)
+}
@@ -0,0 +1,167 @@
+package hsm
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testTryState fails on entry with fail if it's not nil.
+type testTryState struct {
+	*testState
+	fail error
+}
+
+func (self *testTryState) TryEntry(sm HSM, event Event) error {
+	if self.fail != nil {
+		return self.fail
+	}
+	*self.log = append(*self.log, self.id+"-Entry")
+	return nil
+}
+
+// newTestTryHSM() builds the state machine where s1 transfers to s211
+// on A, and s21 fails on entry with fail.
+func newTestTryHSM(log *[]string, fail error) *StdHSM {
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	newTestState(top, "s1", "", map[EventType]string{
+		testEventA: "s211",
+		testEventB: "s2",
+	}, log)
+	s2 := newTestState(top, "s2", "s21", nil, log)
+	s21 := &testTryState{
+		testState: &testState{
+			StateHead: NewStateHead(s2), id: "s21", init: "s211", log: log},
+		fail: fail,
+	}
+	s2.AddChild(s21)
+	newTestState(s21, "s211", "", nil, log)
+	return NewStdHSM(HSMTypeStd, top, initial)
+}
+
+func TestTransactionRollback(t *testing.T) {
+	var log []string
+	fail := errors.New("no resource")
+	sm := newTestTryHSM(&log, fail)
+	sm.Transactional = true
+	sm.Init()
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s1", sm.GetState().ID())
+	// s2 is exited to compensate its entry, and s1 is entered again
+	assert.Equal(t, []string{"s1-Exit", "s2-Entry", "s2-Exit", "s1-Entry"}, log)
+	err, ok := sm.Err.(*TransitionError)
+	assert.True(t, ok)
+	assert.Equal(t, "s21", err.StateID)
+	assert.Equal(t, TraceEntry, err.Kind)
+	assert.Equal(t, []string{"s1-Exit", "s2-Entry"}, err.Steps)
+	assert.True(t, errors.Is(sm.Err, fail))
+	assert.Equal(t, "transition on event A failed at s21-Entry: "+
+		"no resource after s1-Exit, s2-Entry", err.Error())
+
+	// it's done in the cached transition chain as well
+	for i := 0; i < 2; i++ {
+		log = nil
+		sm.Dispatch(NewStdEvent(testEventA))
+		assert.Equal(t, "s1", sm.GetState().ID())
+		assert.Equal(t,
+			[]string{"s1-Exit", "s2-Entry", "s2-Exit", "s1-Entry"}, log)
+		assert.NotNil(t, sm.Err)
+	}
+
+	// the failure through initial transitions is rolled back too
+	sm.Dispatch(NewStdEvent(testEventB))
+	assert.Equal(t, "s1", sm.GetState().ID())
+	assert.NotNil(t, sm.Err)
+}
+
+func TestTransactionCommit(t *testing.T) {
+	var log []string
+	sm := newTestTryHSM(&log, nil)
+	sm.Transactional = true
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s211", sm.GetState().ID())
+	assert.Nil(t, sm.Err)
+}
+
+func TestTryEntryNotTransactional(t *testing.T) {
+	var log []string
+	sm := newTestTryHSM(&log, errors.New("no resource"))
+	sm.Init()
+	assert.Panics(t, func() {
+		sm.Dispatch(NewStdEvent(testEventA))
+	})
+}
+
+// testTryExitState fails on exit.
+type testTryExitState struct {
+	*testState
+}
+
+func (self *testTryExitState) TryExit(sm HSM, event Event) error {
+	return errors.New("busy")
+}
+
+func TestTransactionRollbackExit(t *testing.T) {
+	var log []string
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	s1 := &testTryExitState{&testState{
+		StateHead: NewStateHead(top), id: "s1", init: "s11", log: &log}}
+	top.AddChild(s1)
+	newTestState(s1, "s11", "", map[EventType]string{testEventA: "s2"}, &log)
+	newTestState(top, "s2", "", nil, &log)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.Transactional = true
+	sm.Init()
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s11", sm.GetState().ID())
+	// s1 failed to exit, so only s11 is entered again
+	assert.Equal(t, []string{"s11-Exit", "s11-Entry"}, log)
+	err := sm.Err.(*TransitionError)
+	assert.Equal(t, "s1", err.StateID)
+	assert.Equal(t, TraceExit, err.Kind)
+}
+
+func TestTransactionRollbackHistory(t *testing.T) {
+	var log []string
+	top := NewTop()
+	initial := NewInitial(top, "s1")
+	s1 := newTestState(top, "s1", "s11", map[EventType]string{
+		testEventB: "s2",
+		testEventD: "s3",
+	}, &log)
+	h := NewHistory(s1, "h", false, "")
+	newTestState(s1, "s11", "", map[EventType]string{testEventA: "s12"}, &log)
+	newTestState(s1, "s12", "", nil, &log)
+	top.AddChild(&testTryState{
+		testState: &testState{
+			StateHead: NewStateHead(top), id: "s2", log: &log},
+		fail: errors.New("no resource"),
+	})
+	newTestState(top, "s3", "", map[EventType]string{testEventC: "h"}, &log)
+	sm := NewStdHSM(HSMTypeStd, top, initial)
+	sm.Transactional = true
+	sm.Init()
+	sm.Dispatch(NewStdEvent(testEventD))
+	sm.Dispatch(NewStdEvent(testEventC))
+	sm.Dispatch(NewStdEvent(testEventA))
+	assert.Equal(t, "s12", sm.GetState().ID())
+	assert.Equal(t, "s11", h.Resume())
+
+	// s1 records s12 on exit, which is undone by the rollback
+	log = nil
+	sm.Dispatch(NewStdEvent(testEventB))
+	assert.NotNil(t, sm.Err)
+	assert.Equal(t, []string{"s12-Exit", "s1-Exit", "s1-Entry", "s12-Entry"},
+		log)
+	assert.Equal(t, "s12", sm.GetState().ID())
+	assert.Equal(t, "s12", sm.active.ID())
+	assert.Equal(t, "s11", h.Resume())
+	sm.Dispatch(NewStdEvent(testEventD))
+	sm.Dispatch(NewStdEvent(testEventC))
+	assert.Equal(t, "s12", sm.GetState().ID())
+}
@@ -0,0 +1,62 @@
+package hsm
+
+// Transition describes a state transfer taken by the Handle() of state
+// Source on event Event. An empty Target stands for an internal transition,
+// which handles the event without leaving Source.
+//
+// A transition on EventInit stands for the initial transition of
+// composite state Source, which is taken by its Init() through QInit().
+//
+// The engine never reads declared transitions to dispatch events, states
+// still transfer by calling QTran() and its variants. They are declared
+// for the tools which inspect the structure of a state machine.
+type Transition struct {
+	Source string
+	Event  EventType
+	Target string
+}
+
+// DeclareTransition() records a transition from state sourceID to
+// state targetID on event. Pass an empty targetID for internal transition.
+func (self *StdHSM) DeclareTransition(
+	sourceID string, event EventType, targetID string) {
+
+	_, ok := self.StateTable[sourceID]
+	AssertTrue(ok)
+	if targetID != "" {
+		_, ok = self.StateTable[targetID]
+		AssertTrue(ok)
+	}
+	self.Transitions = append(self.Transitions, Transition{
+		Source: sourceID,
+		Event:  event,
+		Target: targetID,
+	})
+}
+
+// TransitionsFrom() returns all transitions declared on state sourceID.
+func (self *StdHSM) TransitionsFrom(sourceID string) []Transition {
+	var result []Transition
+	for _, tran := range self.Transitions {
+		if tran.Source == sourceID {
+			result = append(result, tran)
+		}
+	}
+	return result
+}
+
+// InitialOf() returns the target of the initial transition of state
+// stateID, or an empty string if it's not declared.
+func (self *StdHSM) InitialOf(stateID string) string {
+	if stateID == TopStateID {
+		if initial, ok := self.StateTable[InitialStateID].(*Initial); ok {
+			return initial.InitStateID
+		}
+	}
+	for _, tran := range self.Transitions {
+		if tran.Source == stateID && tran.Event == EventInit {
+			return tran.Target
+		}
+	}
+	return ""
+}
@@ -4,34 +4,107 @@ import "container/list"
 import "errors"
 
 // Trigger() is a helper function to dispatch event of different types to
-// the corresponding method.
+// the corresponding method. The observers of hsm are notified
+// when the method handles the event.
 func Trigger(hsm HSM, state State, event Event) State {
 	switch event.Type() {
 	case EventEmpty:
 		return state.Super()
 	case EventInit:
-		return state.Init(hsm, event)
+		return TriggerInit(hsm, state, event)
 	case EventEntry:
-		return state.Entry(hsm, event)
+		return TriggerEntry(hsm, state, event)
 	case EventExit:
-		return state.Exit(hsm, event)
+		return TriggerExit(hsm, state, event)
 	default:
-		return state.Handle(hsm, event)
+		return TriggerHandle(hsm, state, event)
 	}
 }
 
 func TriggerInit(hsm HSM, state State, event Event) State {
-	return state.Init(hsm, event)
+	s := state.Init(hsm, event)
+	if s == nil {
+		notify(hsm, TraceInit, state, event)
+	}
+	return s
 }
 
 func TriggerEntry(hsm HSM, state State, event Event) State {
-	return state.Entry(hsm, event)
+	if e, ok := state.(TryEntry); ok {
+		step(hsm, TraceEntry, state, event, e.TryEntry(hsm, event))
+		if h, ok := hsm.(historian); ok {
+			h.entered(state)
+		}
+		return nil
+	}
+	s := state.Entry(hsm, event)
+	if s == nil {
+		step(hsm, TraceEntry, state, event, nil)
+	}
+	if h, ok := hsm.(historian); ok {
+		h.entered(state)
+	}
+	return s
 }
 
 func TriggerExit(hsm HSM, state State, event Event) State {
-	return state.Exit(hsm, event)
+	if h, ok := hsm.(historian); ok {
+		h.exited(state)
+	}
+	if e, ok := state.(TryExit); ok {
+		step(hsm, TraceExit, state, event, e.TryExit(hsm, event))
+		return nil
+	}
+	s := state.Exit(hsm, event)
+	if s == nil {
+		step(hsm, TraceExit, state, event, nil)
+	}
+	return s
 }
 
+// historian is implemented by StdHSM, and so by every HSM which embeds
+// StdHSM, to record the history of the states exited, and the states
+// actually entered in case a transition panics half way.
+type historian interface {
+	exited(state State)
+	entered(state State)
+}
+
+// TriggerHandle() panics on the error returned by state, since only
+// the dispatching knows how to deliver it, see TriggerHandleErr().
+func TriggerHandle(hsm HSM, state State, event Event) State {
+	s, err := TriggerHandleErr(hsm, state, event)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// TriggerHandleErr() calls HandleErr() of state if it implements ErrState,
+// or Handle() otherwise. The events consumed by the top state are not
+// traced, since it drops every event left unhandled by the others.
+func TriggerHandleErr(hsm HSM, state State, event Event) (State, error) {
+	var s State
+	if e, ok := state.(ErrState); ok {
+		var err error
+		if s, err = e.HandleErr(hsm, event); err != nil {
+			return nil, err
+		}
+	} else {
+		s = state.Handle(hsm, event)
+	}
+	if s == nil && state.Super() != nil {
+		notify(hsm, TraceHandle, state, event)
+	}
+	return s, nil
+}
+
+// Record() triggers the callback of stdEvent type on state, and appends
+// it to actions as a *StaticTranAction if it's handled. hsm must embed
+// StdHSM, which indexes state.
+//
+// Deprecated: the chains are recorded in StaticTranChain.Actions
+// by StdHSM itself, see QTranSetup().
 func Record(
 	stdEvent Event, actions *list.List, hsm HSM, state State, event Event) {
 
@@ -48,26 +121,43 @@ func Record(
 		AssertTrue(false)
 	}
 	if trigger(hsm, state, event) == nil {
-		action := &StaticTranAction{
-			State: state,
-			Event: stdEvent,
-		}
-		actions.PushBack(action)
+		indexer, ok := hsm.(stateIndexer)
+		AssertTrue(ok)
+		actions.PushBack(&StaticTranAction{
+			State:   indexer.indexOf(state),
+			Event:   stdEvent.Type(),
+			Handled: true,
+		})
 	}
 }
 
+// RecordInit() is Record() of the init action.
+//
+// Deprecated: see Record().
 func RecordInit(actions *list.List, hsm HSM, state State, event Event) {
 	Record(StdEvents[EventInit], actions, hsm, state, event)
 }
 
+// RecordEntry() is Record() of the entry action.
+//
+// Deprecated: see Record().
 func RecordEntry(actions *list.List, hsm HSM, state State, event Event) {
 	Record(StdEvents[EventEntry], actions, hsm, state, event)
 }
 
+// RecordExit() is Record() of the exit action.
+//
+// Deprecated: see Record().
 func RecordExit(actions *list.List, hsm HSM, state State, event Event) {
 	Record(StdEvents[EventExit], actions, hsm, state, event)
 }
 
+// stateIndexer is implemented by StdHSM, and so by every HSM which
+// embeds StdHSM, for Record().
+type stateIndexer interface {
+	indexOf(state State) int
+}
+
 // ListTruncate() removes elements from `e' to the last element in list `l'.
 // The range to be removed is [e, l.Back()]. It returns list `l'.
 func ListTruncate(l *list.List, e *list.Element) *list.List {